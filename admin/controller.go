@@ -0,0 +1,251 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/audit"
+	"league/emails"
+	"league/helpers"
+	"league/integrity"
+	"league/models"
+	"league/outbox"
+)
+
+func getTemplatesHandler(ctx *gin.Context) {
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched email templates",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"templates":      emails.Templates(),
+			"locales":        emails.Locales(),
+			"default_locale": emails.DefaultLocale,
+		},
+	})
+}
+
+// previewTemplateHandler renders a template with sample data; format=html or format=text returns the body as is
+func previewTemplateHandler(ctx *gin.Context) {
+	name := ctx.Param("name")
+	rendered, err := emails.Render(name, ctx.Query("locale"), emails.SampleData(name))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, emails.ErrUnknownTemplate) {
+			status = http.StatusNotFound
+		}
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: status,
+			Data:       nil,
+		})
+		return
+	}
+
+	switch ctx.Query("format") {
+	case "html":
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(rendered.HTML))
+		return
+	case "text":
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(rendered.Text))
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully rendered email template",
+		StatusCode: http.StatusOK,
+		Data:       rendered,
+	})
+}
+
+func getOutboxHandler(ctx *gin.Context) {
+	messages, total, page, perPage, err := outbox.List(ctx.Query("status"), ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched emails",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     messages,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func getOutboxMessageHandler(ctx *gin.Context) {
+	msg, err := outbox.Get(ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusNotFound,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched email",
+		StatusCode: http.StatusOK,
+		Data:       msg,
+	})
+}
+
+// getOutboxMessageBodyHandler shows what was queued, codes and links included, so it is for super-admins only
+func getOutboxMessageBodyHandler(ctx *gin.Context) {
+	msg, err := outbox.GetWithBody(ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusNotFound,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched email",
+		StatusCode: http.StatusOK,
+		Data:       msg,
+	})
+}
+
+func retryOutboxMessageHandler(ctx *gin.Context) {
+	msg, err := outbox.Retry(ctx.Param("id"))
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, outbox.ErrNotRetryable) {
+			status = http.StatusConflict
+		}
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: status,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully queued email for retry",
+		StatusCode: http.StatusOK,
+		Data:       msg,
+	})
+}
+
+// getAuditHandler lists audit entries, filtered by actor, action, entity (target type and optional target ID) and a from/to time range
+func getAuditHandler(ctx *gin.Context) {
+	filter, err := auditFilter(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	entries, total, page, perPage, err := audit.List(filter, ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched audit log",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     entries,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func auditFilter(ctx *gin.Context) (audit.Filter, error) {
+	filter := audit.Filter{
+		Action:     ctx.Query("action"),
+		TargetType: ctx.Query("entity"),
+		TargetID:   ctx.Query("entity_id"),
+	}
+	if actor := ctx.Query("actor"); actor != "" {
+		actorID, err := primitive.ObjectIDFromHex(actor)
+		if err != nil {
+			return filter, fmt.Errorf("invalid actor: %v", err)
+		}
+		filter.ActorID = actorID
+	}
+	for param, field := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := ctx.Query(param); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%v must be an RFC 3339 time: %v", param, err)
+			}
+			*field = at
+		}
+	}
+	return filter, nil
+}
+
+func getIntegrityHandler(ctx *gin.Context) {
+	checks, err := integrity.Report()
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully checked references",
+		StatusCode: http.StatusOK,
+		Data:       checks,
+	})
+}
+
+// repairIntegrityHandler repairs one relation when relation is given, optionally with another action, or every relation that is not restricted
+func repairIntegrityHandler(ctx *gin.Context) {
+	actor := models.AuditActorFromContext(ctx)
+
+	var (
+		data interface{}
+		err  error
+	)
+	if relation := ctx.Query("relation"); relation != "" {
+		data, err = integrity.Repair(actor, relation, models.OnDelete(ctx.Query("action")))
+	} else {
+		data, err = integrity.RepairAll(actor)
+	}
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully repaired references",
+		StatusCode: http.StatusOK,
+		Data:       data,
+	})
+}
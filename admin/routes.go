@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"league/jwt"
+	"league/middleware"
+	"league/models"
+)
+
+func AdminRoutes(superRoute *gin.RouterGroup) {
+	adminRouter := superRoute.Group("/admin")
+	{
+		adminRouter.Use(jwt.Middleware())
+		adminRouter.GET("/emails/templates", middleware.RequirePermission(models.EmailsRead), getTemplatesHandler)
+		adminRouter.GET("/emails/templates/:name/preview", middleware.RequirePermission(models.EmailsRead), previewTemplateHandler)
+		adminRouter.GET("/emails/outbox", middleware.RequirePermission(models.EmailsRead), getOutboxHandler)
+		adminRouter.GET("/emails/outbox/:id", middleware.RequirePermission(models.EmailsRead), getOutboxMessageHandler)
+		adminRouter.GET("/emails/outbox/:id/body", middleware.RolesMiddleware([]models.Role{models.SuperAdminRole}), getOutboxMessageBodyHandler)
+		adminRouter.POST("/emails/outbox/:id/retry", middleware.RequirePermission(models.EmailsWrite), retryOutboxMessageHandler)
+		adminRouter.GET("/audit", middleware.RequirePermission(models.AuditRead), getAuditHandler)
+		adminRouter.GET("/integrity", middleware.RequirePermission(models.IntegrityRead), getIntegrityHandler)
+		adminRouter.POST("/integrity/repair", middleware.RequirePermission(models.IntegrityWrite), repairIntegrityHandler)
+	}
+}
@@ -0,0 +1,143 @@
+package apikeys
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/db"
+	"league/models"
+)
+
+// createTestUser stores an account the middleware can load for the key's owner
+func createTestUser(t *testing.T, role models.Role) *models.User {
+	user := models.User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     primitive.NewObjectID().Hex() + "@example.com",
+		RoleName:  role,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	result, err := db.GetCollection(db.MongoClient, "users").InsertOne(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	user.Id = result.InsertedID.(primitive.ObjectID)
+	return &user
+}
+
+func TestParsePrefix(t *testing.T) {
+	prefix, ok := parsePrefix("lk_abcd1234_secret")
+	assert.True(t, ok)
+	assert.Equal(t, "abcd1234", prefix)
+
+	for _, key := range []string{"", "abcd1234_secret", "lk_abcd1234", "lk__secret", "lk_abcd1234_"} {
+		_, ok := parsePrefix(key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestDailyQuota(t *testing.T) {
+	admin := &models.User{RoleName: models.AdminRole}
+	superAdmin := &models.User{RoleName: models.SuperAdminRole}
+
+	quota, err := dailyQuota(admin, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultDailyQuota, quota)
+
+	quota, err = dailyQuota(admin, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), quota)
+
+	// only super-admins can raise a key above the configured quota
+	_, err = dailyQuota(admin, defaultDailyQuota+1)
+	assert.Error(t, err)
+	quota, err = dailyQuota(superAdmin, defaultDailyQuota+1)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultDailyQuota+1, quota)
+}
+
+func TestCreateAPIKey_Scopes(t *testing.T) {
+	admin := createTestUser(t, models.AdminRole)
+
+	// a key can never do more than its owner
+	_, err := createAPIKey(admin, APIKeyRequest{Name: "roles", Scopes: []models.Permission{models.RolesWrite}})
+	assert.EqualError(t, err, "your role does not grant roles:write")
+
+	_, err = createAPIKey(admin, APIKeyRequest{Name: "unknown", Scopes: []models.Permission{"fixtures:read"}})
+	assert.EqualError(t, err, "fixtures:read is not a valid permission")
+}
+
+func TestAuthenticate(t *testing.T) {
+	admin := createTestUser(t, models.AdminRole)
+	created, err := createAPIKey(admin, APIKeyRequest{Name: "scoreboard", Scopes: []models.Permission{models.FixturesStats}})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultDailyQuota, created.DailyQuota)
+
+	key, err := Authenticate(created.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, key.ID)
+
+	// the right prefix with the wrong secret is not enough
+	_, err = Authenticate(keyPrefix + created.Prefix + "_wrong")
+	assert.Equal(t, ErrInvalidKey, err)
+	_, err = Authenticate("not-a-key")
+	assert.Equal(t, ErrInvalidKey, err)
+
+	assert.NoError(t, revokeAPIKey(admin.Id, created.ID.Hex()))
+	_, err = Authenticate(created.Key)
+	assert.Equal(t, ErrInvalidKey, err)
+}
+
+func TestAuthenticate_QuotaExceeded(t *testing.T) {
+	admin := createTestUser(t, models.AdminRole)
+	created, err := createAPIKey(admin, APIKeyRequest{Name: "scoreboard", Scopes: []models.Permission{models.FixturesStats}, DailyQuota: 2})
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = Authenticate(created.Key)
+		assert.NoError(t, err)
+	}
+	_, err = Authenticate(created.Key)
+	assert.Equal(t, ErrQuotaExceeded, err)
+
+	usage, err := getUsage(&created.APIKey, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), usage.RemainingToday)
+}
+
+func TestMiddleware(t *testing.T) {
+	admin := createTestUser(t, models.AdminRole)
+	created, err := createAPIKey(admin, APIKeyRequest{Name: "scoreboard", Scopes: []models.Permission{models.FixturesStats}, DailyQuota: 1})
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var scopes interface{}
+	router.GET("/", Middleware(), func(c *gin.Context) {
+		scopes, _ = c.Get("scopes")
+		c.Status(http.StatusOK)
+	})
+	serve := func(key string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(Header, key)
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve("lk_unknown_key"))
+
+	// the request is narrowed to the key's scopes rather than the owner's role
+	assert.Equal(t, http.StatusOK, serve(created.Key))
+	assert.Equal(t, []models.Permission{models.FixturesStats}, scopes)
+
+	assert.Equal(t, http.StatusTooManyRequests, serve(created.Key))
+}
@@ -0,0 +1,34 @@
+package apikeys
+
+import (
+	"time"
+
+	"league/models"
+)
+
+type APIKeyRequest struct {
+	Name          string              `json:"name" binding:"required,min=3"`
+	Scopes        []models.Permission `json:"scopes" binding:"required"`
+	ExpiresInDays int                 `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+	DailyQuota    int64               `json:"daily_quota" binding:"omitempty,min=1"`
+}
+
+// CreatedAPIKey is only returned once, when the key is issued
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+type DailyUsage struct {
+	Date     string `json:"date"`
+	Requests int64  `json:"requests"`
+}
+
+type Usage struct {
+	KeyID          string       `json:"key_id"`
+	TotalRequests  int64        `json:"total_requests"`
+	DailyQuota     int64        `json:"daily_quota"`
+	RemainingToday int64        `json:"remaining_today"`
+	LastUsedAt     *time.Time   `json:"last_used_at"`
+	Days           []DailyUsage `json:"days"`
+}
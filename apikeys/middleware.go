@@ -0,0 +1,57 @@
+package apikeys
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"league/helpers"
+	"league/jwt"
+	"league/models"
+)
+
+const Header = "X-API-Key"
+
+// Middleware authenticates machine clients by the X-API-Key header
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := Authenticate(c.Request.Header.Get(Header))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrInvalidKey) {
+				status = http.StatusUnauthorized
+			} else if errors.Is(err, ErrQuotaExceeded) {
+				status = http.StatusTooManyRequests
+			}
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: status,
+				Data:       nil,
+			})
+			return
+		}
+
+		user, err := jwt.GetUser(key.UserID)
+		if err != nil {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusInternalServerError,
+				Data:       nil,
+			})
+			return
+		}
+		if user.IsSuspended() {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    models.ErrSuspended.Error(),
+				StatusCode: http.StatusForbidden,
+				Data:       nil,
+			})
+			return
+		}
+		c.Set("api_key", *key)
+		c.Set("scopes", key.Scopes)
+		c.Set("user", user)
+		c.Next()
+	}
+}
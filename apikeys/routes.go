@@ -0,0 +1,19 @@
+package apikeys
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"league/jwt"
+)
+
+func APIKeyRoutes(superRoute *gin.RouterGroup) {
+	keyRouter := superRoute.Group("/users/user/api-keys")
+	{
+		// keys are managed with a user session only, never with another key
+		keyRouter.Use(jwt.Middleware())
+		keyRouter.POST("/", jwt.NotImpersonating(), createHandler)
+		keyRouter.GET("/", getHandler)
+		keyRouter.DELETE("/:id", jwt.NotImpersonating(), revokeHandler)
+		keyRouter.GET("/:id/usage", usageHandler)
+	}
+}
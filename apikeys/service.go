@@ -0,0 +1,355 @@
+package apikeys
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/models"
+	cisredis "league/redis"
+	"league/roles"
+
+	"github.com/go-redis/redis/v8"
+
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var apiKeyCollection *mongo.Collection = db.GetCollection(db.MongoClient, "api_keys")
+var duration time.Duration = 10 * time.Second
+
+const keyPrefix = "lk_"
+
+var defaultDailyQuota int64 = 10000
+
+var ErrInvalidKey = errors.New("invalid api key")
+var ErrQuotaExceeded = errors.New("api key daily quota exceeded")
+
+func init() {
+	//check for prefix index
+	exists, err := db.IsIndexExists(context.Background(), apiKeyCollection, "prefix")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !exists {
+		err = db.IndexField(*apiKeyCollection, "prefix", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	userExists, err := db.IsIndexExists(context.Background(), apiKeyCollection, "user_id")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !userExists {
+		err = db.IndexNormalField(*apiKeyCollection, "user_id", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	if quota := os.Getenv("API_KEY_DAILY_QUOTA"); quota != "" {
+		if value, err := strconv.ParseInt(quota, 10, 64); err == nil {
+			defaultDailyQuota = value
+		}
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// parsePrefix extracts the public prefix out of a key shaped like lk_<prefix>_<secret>
+func parsePrefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, keyPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func usageKey(ID primitive.ObjectID, day time.Time) string {
+	return fmt.Sprintf("apikey:%s:%s", ID.Hex(), day.UTC().Format("2006-01-02"))
+}
+
+func totalKey(ID primitive.ObjectID) string {
+	return fmt.Sprintf("apikey:%s:total", ID.Hex())
+}
+
+func lastUsedKey(ID primitive.ObjectID) string {
+	return fmt.Sprintf("apikey:%s:last_used", ID.Hex())
+}
+
+// dailyQuota is the quota a new key gets; only super-admins can go above API_KEY_DAILY_QUOTA
+func dailyQuota(user *models.User, requested int64) (int64, error) {
+	if requested == 0 {
+		return defaultDailyQuota, nil
+	}
+	if requested > defaultDailyQuota && user.RoleName != models.SuperAdminRole {
+		return 0, fmt.Errorf("daily quota cannot be more than %d", defaultDailyQuota)
+	}
+	return requested, nil
+}
+
+func createAPIKey(user *models.User, req APIKeyRequest) (*CreatedAPIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	// a key can never do more than its owner
+	granted, err := roles.GetPermissions(user.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidPermission(scope) {
+			return nil, fmt.Errorf("%v is not a valid permission", scope)
+		}
+		if !models.HasPermission(granted, scope) {
+			return nil, fmt.Errorf("your role does not grant %v", scope)
+		}
+	}
+
+	quota, err := dailyQuota(user, req.DailyQuota)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := randomHex(4)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(20)
+	if err != nil {
+		return nil, err
+	}
+	key := keyPrefix + prefix + "_" + secret
+
+	apiKey := models.APIKey{
+		UserID:     user.Id,
+		Name:       req.Name,
+		Prefix:     prefix,
+		KeyHash:    hashKey(key),
+		Scopes:     req.Scopes,
+		DailyQuota: quota,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if req.ExpiresInDays != 0 {
+		apiKey.ExpiresAt = time.Now().AddDate(0, 0, req.ExpiresInDays)
+	}
+
+	result, err := apiKeyCollection.InsertOne(ctx, apiKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not create api key: %v", err)
+	}
+	apiKey.ID = result.InsertedID.(primitive.ObjectID)
+
+	return &CreatedAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+func getAPIKeys(userID primitive.ObjectID) ([]models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	return findAPIKeys(ctx, userID)
+}
+
+func findAPIKeys(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := apiKeyCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find api keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	keys := make([]models.APIKey, 0)
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode api keys: %w", err)
+	}
+	return keys, nil
+}
+
+func getAPIKey(userID primitive.ObjectID, ID string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	var key models.APIKey
+	err = apiKeyCollection.FindOne(ctx, bson.M{"_id": objID, "user_id": userID}).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no api key found with ID %s", ID)
+		}
+		return nil, fmt.Errorf("failed to fetch api key: %v", err)
+	}
+	return &key, nil
+}
+
+func revokeAPIKey(userID primitive.ObjectID, ID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	result, err := apiKeyCollection.UpdateOne(ctx,
+		bson.M{"_id": objID, "user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now(), "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("could not revoke api key: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no active api key found with ID %s", ID)
+	}
+	return nil
+}
+
+// DeleteForUser removes every key a user owns; ctx is the transaction the deletion is part of.
+// The deleted keys are returned so their usage counters can be dropped with ForgetUsage once the transaction has committed
+func DeleteForUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIKey, error) {
+	keys, err := findAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = apiKeyCollection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("could not delete api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// ForgetUsage drops the usage counters of deleted keys
+func ForgetUsage(keys []models.APIKey) error {
+	for _, key := range keys {
+		for _, redisKey := range []string{totalKey(key.ID), lastUsedKey(key.ID), usageKey(key.ID, time.Now()), usageKey(key.ID, time.Now().AddDate(0, 0, -1))} {
+			if err := cisredis.Delete(redisKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func getUsage(key *models.APIKey, days int) (*Usage, error) {
+	usage := Usage{
+		KeyID:      key.ID.Hex(),
+		DailyQuota: key.DailyQuota,
+		Days:       make([]DailyUsage, 0, days),
+	}
+
+	now := time.Now().UTC()
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i)
+		count, err := readCounter(usageKey(key.ID, day))
+		if err != nil {
+			return nil, err
+		}
+		usage.Days = append(usage.Days, DailyUsage{Date: day.Format("2006-01-02"), Requests: count})
+	}
+	usage.RemainingToday = key.DailyQuota - usage.Days[0].Requests
+	if usage.RemainingToday < 0 {
+		usage.RemainingToday = 0
+	}
+
+	total, err := readCounter(totalKey(key.ID))
+	if err != nil {
+		return nil, err
+	}
+	usage.TotalRequests = total
+
+	lastUsed, err := cisredis.Retrieve(lastUsedKey(key.ID))
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if lastUsed != "" {
+		if at, err := time.Parse(time.RFC3339, lastUsed); err == nil {
+			usage.LastUsedAt = &at
+		}
+	}
+	return &usage, nil
+}
+
+func readCounter(key string) (int64, error) {
+	value, err := cisredis.Retrieve(key)
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Authenticate resolves a raw key to its active record and records the request against its quota
+func Authenticate(rawKey string) (*models.APIKey, error) {
+	prefix, ok := parsePrefix(rawKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var key models.APIKey
+	err := apiKeyCollection.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidKey
+		}
+		return nil, fmt.Errorf("failed to fetch api key: %v", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashKey(rawKey)), []byte(key.KeyHash)) != 1 || !key.IsActive() {
+		return nil, ErrInvalidKey
+	}
+
+	count, err := cisredis.Increment(usageKey(key.ID, time.Now()), 48*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if count > key.DailyQuota {
+		return nil, ErrQuotaExceeded
+	}
+	if _, err := cisredis.Increment(totalKey(key.ID), 0); err != nil {
+		return nil, err
+	}
+	if err := cisredis.Store(lastUsedKey(key.ID), time.Now().UTC().Format(time.RFC3339), 0); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+)
+
+func TestDiff(t *testing.T) {
+	before := models.Fixture{ID: primitive.NewObjectID(), Status: models.Pending, Referee: "Taylor"}
+	after := before
+	after.Status = models.Completed
+	after.Home.Goals = 2
+
+	changes, err := Diff(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AuditChange{
+		{Field: "home.goals", Before: int32(0), After: int32(2)},
+		{Field: "status", Before: "pending", After: "completed"},
+	}, changes)
+}
+
+func TestDiffCreateAndDelete(t *testing.T) {
+	team := models.Team{ID: primitive.NewObjectID(), Name: "Rovers"}
+
+	created, err := Diff(nil, team)
+	assert.NoError(t, err)
+	assert.Contains(t, created, models.AuditChange{Field: "name", After: "Rovers"})
+
+	deleted, err := Diff(team, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, deleted, models.AuditChange{Field: "name", Before: "Rovers"})
+}
+
+func TestDiffRedactsSecrets(t *testing.T) {
+	before := models.User{Password: "old-hash", FirstName: "Ada"}
+	after := models.User{Password: "new-hash", FirstName: "Ada"}
+
+	changes, err := Diff(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AuditChange{{Field: "password", Before: redacted, After: redacted}}, changes)
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// redacted replaces secrets in a diff, the entry still shows that they changed
+const redacted = "[redacted]"
+
+var secretFields = map[string]bool{
+	"password":           true,
+	"password_history":   true,
+	"verification_token": true,
+	"token_hash":         true,
+}
+
+// ignoredFields change on every write and would only add noise
+var ignoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// Diff lists the fields that differ between two versions of a document as they are stored;
+// pass nil as before for a create and nil as after for a delete
+func Diff(before interface{}, after interface{}) ([]models.AuditChange, error) {
+	old, err := flatten(before)
+	if err != nil {
+		return nil, err
+	}
+	current, err := flatten(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]bool{}
+	for field := range old {
+		fields[field] = true
+	}
+	for field := range current {
+		fields[field] = true
+	}
+
+	changes := make([]models.AuditChange, 0)
+	for field := range fields {
+		if ignoredFields[field] {
+			continue
+		}
+		was, had := old[field]
+		is, has := current[field]
+		if had == has && reflect.DeepEqual(was, is) {
+			continue
+		}
+		change := models.AuditChange{Field: field, Before: was, After: is}
+		if secretFields[field] {
+			change.Before, change.After = nil, nil
+			if had {
+				change.Before = redacted
+			}
+			if has {
+				change.After = redacted
+			}
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// flatten turns a document into dotted paths so a change to home.goals does not report the whole of home
+func flatten(document interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if document == nil || reflect.ValueOf(document).IsZero() {
+		return fields, nil
+	}
+
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("could not diff document: %v", err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("could not diff document: %v", err)
+	}
+	flattenInto(fields, "", doc)
+	return fields, nil
+}
+
+func flattenInto(fields map[string]interface{}, prefix string, doc bson.D) {
+	for _, e := range doc {
+		field := e.Key
+		if prefix != "" {
+			field = prefix + "." + e.Key
+		}
+		switch value := e.Value.(type) {
+		case bson.D:
+			flattenInto(fields, field, value)
+		case primitive.M:
+			nested := make(bson.D, 0, len(value))
+			for k, v := range value {
+				nested = append(nested, bson.E{Key: k, Value: v})
+			}
+			flattenInto(fields, field, nested)
+		default:
+			fields[field] = value
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/models"
+
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var auditCollection *mongo.Collection = db.GetCollection(db.MongoClient, "audit_log")
+var duration time.Duration = 10 * time.Second
+
+func init() {
+	//check for actor index
+	exists, err := db.IsIndexExists(context.Background(), auditCollection, "actor_id")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !exists {
+		err = db.IndexNormalField(*auditCollection, "actor_id", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	//check for target index, it serves the history of a single entity
+	targetExists, err := db.IsIndexExists(context.Background(), auditCollection, "target_type")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !targetExists {
+		err = db.IndexCompound(*auditCollection, bson.M{"target_type": 1, "target_id": 1}, 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	//check for created_at index, used by time range filters
+	createdExists, err := db.IsIndexExists(context.Background(), auditCollection, "created_at")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !createdExists {
+		err = db.IndexNormalField(*auditCollection, "created_at", -1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+}
+
+// Record appends an entry to the audit log; entries are never updated or deleted.
+// Inside a transaction ctx must be the transaction's so the entry commits with the change
+func Record(ctx context.Context, entry models.AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	_, err := auditCollection.InsertOne(ctx, entry)
+	if err != nil {
+		fmt.Printf("could not write audit entry: %v \n", err)
+		return fmt.Errorf("could not write audit entry: %v", err)
+	}
+	return nil
+}
+
+// Change records a mutation together with the fields it changed; before is nil for creates and after for deletes.
+// Changes without an actor are made by users to their own account and are not recorded
+func Change(ctx context.Context, actor models.AuditActor, action string, targetType string, targetID primitive.ObjectID, before interface{}, after interface{}) error {
+	if actor.IsZero() {
+		return nil
+	}
+	changes, err := Diff(before, after)
+	if err != nil {
+		return err
+	}
+	return Record(ctx, models.AuditEntry{
+		ActorID:        actor.UserID,
+		ImpersonatedID: actor.ImpersonatedID,
+		Action:         action,
+		TargetType:     targetType,
+		TargetID:       targetID.Hex(),
+		Changes:        changes,
+		IP:             actor.IP,
+		RequestID:      actor.RequestID,
+	})
+}
+
+// Filter narrows the audit log, zero fields match everything
+type Filter struct {
+	ActorID    primitive.ObjectID
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+}
+
+func (f Filter) query() bson.M {
+	query := bson.M{}
+	if !f.ActorID.IsZero() {
+		query["actor_id"] = f.ActorID
+	}
+	if f.Action != "" {
+		query["action"] = f.Action
+	}
+	if f.TargetType != "" {
+		query["target_type"] = f.TargetType
+	}
+	if f.TargetID != "" {
+		query["target_id"] = f.TargetID
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		created := bson.M{}
+		if !f.From.IsZero() {
+			created["$gte"] = f.From
+		}
+		if !f.To.IsZero() {
+			created["$lte"] = f.To
+		}
+		query["created_at"] = created
+	}
+	return query
+}
+
+// List returns audit entries newest first
+func List(filter Filter, pageNumber string, pageSize string) ([]models.AuditEntry, int64, int64, int64, error) {
+	perPage := int64(15)
+	page := int64(1)
+
+	if pageSize != "" {
+		if perPageNum, err := strconv.Atoi(pageSize); err == nil {
+			perPage = int64(perPageNum)
+		}
+	}
+
+	if pageNumber != "" {
+		if num, err := strconv.Atoi(pageNumber); err == nil {
+			page = int64(num)
+		}
+	}
+
+	offset := (page - 1) * perPage
+	query := filter.query()
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	fOpt := options.FindOptions{Limit: &perPage, Skip: &offset, Sort: bson.D{{Key: "created_at", Value: -1}}}
+
+	total, err := auditCollection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to count audit entries: %v", err)
+	}
+
+	cursor, err := auditCollection.Find(ctx, query, &fOpt)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to find audit entries: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]models.AuditEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to decode audit entries: %v", err)
+	}
+
+	return entries, total, page, perPage, nil
+}
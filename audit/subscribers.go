@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"league/events"
+	"league/models"
+
+	"context"
+)
+
+// entries are written in the transaction that makes the change, a change is only saved together with its entry
+func init() {
+	events.SubscribeInTransaction(func(ctx context.Context, e events.ImpersonationStarted) error {
+		return Record(ctx, models.AuditEntry{
+			ActorID:        e.Actor.UserID,
+			ImpersonatedID: e.Target.Id,
+			Action:         models.AuditImpersonationStart,
+			TargetType:     "user",
+			TargetID:       e.Target.Id.Hex(),
+			IP:             e.Actor.IP,
+			RequestID:      e.Actor.RequestID,
+		})
+	})
+
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureCreated) error {
+		return Change(ctx, e.Actor, models.AuditFixtureCreate, "fixture", e.Fixture.ID, nil, e.Fixture)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureUpdated) error {
+		return Change(ctx, e.Actor, models.AuditFixtureUpdate, "fixture", e.After.ID, e.Before, e.After)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureStatsUpdated) error {
+		return Change(ctx, e.Actor, models.AuditFixtureStats, "fixture", e.After.ID, e.Before, e.After)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureRestored) error {
+		return Change(ctx, e.Actor, models.AuditFixtureRestore, "fixture", e.After.ID, e.Before, e.After)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureDeleted) error {
+		return Change(ctx, e.Actor, models.AuditFixtureDelete, "fixture", e.Fixture.ID, e.Fixture, nil)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureUndeleted) error {
+		return Change(ctx, e.Actor, models.AuditFixtureUndelete, "fixture", e.Fixture.ID, nil, e.Fixture)
+	})
+
+	events.SubscribeInTransaction(func(ctx context.Context, e events.TeamCreated) error {
+		return Change(ctx, e.Actor, models.AuditTeamCreate, "team", e.Team.ID, nil, e.Team)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.TeamUpdated) error {
+		return Change(ctx, e.Actor, models.AuditTeamUpdate, "team", e.Team.ID, e.Before, e.Team)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.TeamDeleted) error {
+		return Change(ctx, e.Actor, models.AuditTeamDelete, "team", e.Team.ID, e.Team, nil)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.TeamUndeleted) error {
+		return Change(ctx, e.Actor, models.AuditTeamUndelete, "team", e.Team.ID, nil, e.Team)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.PlayerUpdated) error {
+		return Change(ctx, e.Actor, models.AuditPlayerUpdate, "player", e.After.ID, e.Before, e.After)
+	})
+
+	events.SubscribeInTransaction(func(ctx context.Context, e events.UserRoleChanged) error {
+		return Change(ctx, e.Actor, models.AuditUserRole, "user", e.After.Id, e.Before, e.After)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.UserClubsChanged) error {
+		return Change(ctx, e.Actor, models.AuditUserClubs, "user", e.After.Id, e.Before, e.After)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.UserSuspended) error {
+		action := models.AuditUserUnsuspend
+		if e.Suspended {
+			action = models.AuditUserSuspend
+		}
+		return Change(ctx, e.Actor, action, "user", e.After.Id, e.Before, e.After)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.PasswordResetForced) error {
+		return Change(ctx, e.Actor, models.AuditUserPasswordReset, "user", e.User.Id, nil, nil)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.UserDeleted) error {
+		return Change(ctx, e.Actor, models.AuditUserDelete, "user", e.UserID, nil, nil)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.UserUndeleted) error {
+		return Change(ctx, e.Actor, models.AuditUserUndelete, "user", e.User.Id, nil, nil)
+	})
+
+	events.SubscribeInTransaction(func(ctx context.Context, e events.RoleCreated) error {
+		return Change(ctx, e.Actor, models.AuditRoleCreate, "role", e.Role.ID, nil, e.Role)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.RoleUpdated) error {
+		return Change(ctx, e.Actor, models.AuditRoleUpdate, "role", e.After.ID, e.Before, e.After)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.RoleDeleted) error {
+		return Change(ctx, e.Actor, models.AuditRoleDelete, "role", e.Role.ID, e.Role, nil)
+	})
+
+	events.SubscribeInTransaction(func(ctx context.Context, e events.InviteCreated) error {
+		return Change(ctx, e.Actor, models.AuditInviteCreate, "invite", e.Invite.ID, nil, e.Invite)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.InviteRevoked) error {
+		return Change(ctx, e.Actor, models.AuditInviteRevoke, "invite", e.After.ID, e.Before, e.After)
+	})
+
+	events.SubscribeInTransaction(func(ctx context.Context, e events.IntegrityRepaired) error {
+		return Record(ctx, models.AuditEntry{
+			ActorID:        e.Actor.UserID,
+			ImpersonatedID: e.Actor.ImpersonatedID,
+			Action:         models.AuditIntegrityRepair,
+			TargetType:     "relation",
+			TargetID:       e.Relation,
+			Changes: []models.AuditChange{
+				{Field: "action", After: e.Action},
+				{Field: "repaired", After: e.Repaired},
+			},
+			IP:        e.Actor.IP,
+			RequestID: e.Actor.RequestID,
+		})
+	})
+}
@@ -7,11 +7,14 @@ import (
 	"time"
 
 	"league/models"
+	"league/oidc"
+	cisredis "league/redis"
 
 	"github.com/stretchr/testify/assert"
 	// "go.mongodb.org/mongo-driver/bson"
 	// "go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -51,6 +54,7 @@ func setupTestEnvironment(t *testing.T) {
 
 	// Set up the database and collection
 	userCollection = client.Database(testDatabase).Collection("users")
+	inviteCollection = client.Database(testDatabase).Collection("invites")
 }
 
 func cleanupTestEnvironment(t *testing.T) {
@@ -214,6 +218,32 @@ func TestGetUserFromOtp_ExpiredToken(t *testing.T) {
 	assert.Nil(t, foundUser)
 }
 
+func TestGetUserFromOtp_TooManyFailures(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	email := "john11@example.com"
+	var user models.User
+	assert.NoError(t, userCollection.FindOne(context.Background(), bson.M{"email": email}).Decode(&user))
+	assert.NoError(t, cisredis.Delete(otpFailKey(user.Id)))
+
+	update := bson.M{"verification_token": "1234", "expires_at": time.Now().Add(24 * time.Hour), "updated_at": time.Now()}
+	_, err := userCollection.UpdateOne(context.Background(), bson.M{"email": email}, bson.M{"$set": update})
+	assert.NoError(t, err)
+
+	for i := 1; i < maxOtpFailures; i++ {
+		_, err = getUserFromOtp("0000", email)
+		assert.EqualError(t, err, "invalid verification token")
+	}
+	_, err = getUserFromOtp("0000", email)
+	assert.Equal(t, ErrTooManyOtpFailures, err)
+
+	// the code is gone, guessing it now is no use
+	foundUser, err := getUserFromOtp("1234", email)
+	assert.Error(t, err)
+	assert.Nil(t, foundUser)
+}
+
 func TestForgotPassword_UserNotFound(t *testing.T) {
 	// Set up test environment
 	setupTestEnvironment(t)
@@ -254,10 +284,144 @@ func TestChangePassword_Success(t *testing.T) {
 	err := userCollection.FindOne(context.Background(), bson.M{"email": "john11@example.com"}).Decode(&user)
 	assert.NoError(t, err)
 
-	err = changePassword(user.Id, "123456789")
+	err = changePassword(user.Id, "Kickoff-Time-42")
 		assert.NoError(t, err)
 
 	// Assert that the function returns no error
 	assert.NoError(t, err)
 
 }
+
+// inviteEmail is unique per run so the invite tests can be repeated against the same database
+func inviteEmail(name string) string {
+	return fmt.Sprintf("%v%d@example.com", name, time.Now().UnixNano())
+}
+
+// superAdmin is an inviter allowed to hand out any role
+func superAdmin() *models.User {
+	return &models.User{Id: primitive.NewObjectID(), RoleName: models.SuperAdminRole}
+}
+
+func TestAcceptInvite_Success(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	email := inviteEmail("invited")
+	invite, token, err := createInvite(models.AuditActor{}, email, models.ClubAdminRole, superAdmin(), time.Hour)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, models.InvitePending, invite.Status)
+	// only the hash of the token is stored
+	assert.NotEqual(t, token, invite.TokenHash)
+
+	// the invite decides the email and role, not the signup form
+	user, err := acceptInvite(token, models.User{FirstName: "John", LastName: "Doe", Email: "someone@else.com", RoleName: models.SuperAdminRole})
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+	assert.Equal(t, email, user.Email)
+	assert.Equal(t, models.ClubAdminRole, user.RoleName)
+
+	var accepted models.Invite
+	err = inviteCollection.FindOne(context.Background(), bson.M{"_id": invite.ID}).Decode(&accepted)
+	assert.NoError(t, err)
+	assert.Equal(t, models.InviteAccepted, accepted.Status)
+}
+
+func TestAcceptInvite_Reused(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	_, token, err := createInvite(models.AuditActor{}, inviteEmail("reused"), models.AdminRole, superAdmin(), time.Hour)
+	assert.NoError(t, err)
+
+	_, err = acceptInvite(token, models.User{FirstName: "John", LastName: "Doe"})
+	assert.NoError(t, err)
+
+	user, err := acceptInvite(token, models.User{FirstName: "Jane", LastName: "Doe"})
+	assert.Nil(t, user)
+	assert.EqualError(t, err, "invite is invalid or has expired")
+}
+
+func TestAcceptInvite_Expired(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	email := inviteEmail("expired")
+	_, token, err := createInvite(models.AuditActor{}, email, models.AdminRole, superAdmin(), -time.Hour)
+	assert.NoError(t, err)
+
+	user, err := acceptInvite(token, models.User{FirstName: "John", LastName: "Doe"})
+	assert.Nil(t, user)
+	assert.EqualError(t, err, "invite is invalid or has expired")
+
+	// no account is created for an expired invite
+	count, err := userCollection.CountDocuments(context.Background(), bson.M{"email": email})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestAcceptInvite_Superseded(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	email := inviteEmail("superseded")
+	_, first, err := createInvite(models.AuditActor{}, email, models.AdminRole, superAdmin(), time.Hour)
+	assert.NoError(t, err)
+	_, second, err := createInvite(models.AuditActor{}, email, models.ClubAdminRole, superAdmin(), time.Hour)
+	assert.NoError(t, err)
+
+	_, err = acceptInvite(first, models.User{FirstName: "John", LastName: "Doe"})
+	assert.EqualError(t, err, "invite is invalid or has expired")
+
+	user, err := acceptInvite(second, models.User{FirstName: "John", LastName: "Doe"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClubAdminRole, user.RoleName)
+}
+
+func TestCreateInvite_UserRole(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	invite, token, err := createInvite(models.AuditActor{}, inviteEmail("fan"), models.UserRole, superAdmin(), time.Hour)
+	assert.Nil(t, invite)
+	assert.Empty(t, token)
+	assert.EqualError(t, err, "fans sign up themselves and cannot be invited")
+}
+
+func TestCreateInvite_PrivilegedRole(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	admin := &models.User{Id: primitive.NewObjectID(), RoleName: models.AdminRole}
+	invite, token, err := createInvite(models.AuditActor{}, inviteEmail("escalate"), models.SuperAdminRole, admin, time.Hour)
+	assert.Nil(t, invite)
+	assert.Empty(t, token)
+	assert.Equal(t, ErrPrivilegedInvite, err)
+
+	// a super-admin may invite another
+	invite, _, err = createInvite(models.AuditActor{}, inviteEmail("super"), models.SuperAdminRole, superAdmin(), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SuperAdminRole, invite.RoleName)
+}
+
+func TestFindOrCreateOIDCUser_PromotedStaff(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	// a fan linked to a provider and later promoted to admin
+	subject := primitive.NewObjectID().Hex()
+	_, err := createUser(models.User{
+		FirstName:  "John",
+		LastName:   "Doe",
+		Email:      inviteEmail("promoted"),
+		RoleName:   models.AdminRole,
+		Identities: []models.Identity{{Provider: "google", Subject: subject, LinkedAt: time.Now()}},
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	})
+	assert.NoError(t, err)
+
+	user, err := findOrCreateOIDCUser("google", &oidc.Claims{Subject: subject})
+	assert.Nil(t, user)
+	assert.Equal(t, ErrStaffOIDCLogin, err)
+}
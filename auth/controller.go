@@ -1,10 +1,11 @@
 package auth
 
 import (
-	// "errors"
-	// "fmt"
+	"errors"
 	// "log"
+	"math"
 	"net/http"
+	"strconv"
 	// "strings"
 	// "net/url"
 	// "os"
@@ -13,9 +14,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"league/emails"
+	"league/events"
 	"league/helpers"
 	"league/jwt" //remove during unit tests
 	"league/models"
+	"league/passwords"
+	"league/sessions"
 	// "league/models"
 	// "league/notifications"
 )
@@ -30,7 +35,15 @@ func signUpUserHandler(ctx *gin.Context) {
 		})
 		return
 	}
-	hash, err := helpers.HashPassword(req.Password, 8)
+	if err := passwords.Validate(req.Password, req.Email, req.FirstName, req.LastName); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+	hash, err := passwords.Hash(req.Password)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -76,11 +89,11 @@ func loginUserHandler(ctx *gin.Context) {
 		})
 		return
 	}
-	user, err := getUserByEmail(req.Email)
+	user, err := authenticate(req.Email, req.Password, ctx.ClientIP())
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
-			StatusCode: http.StatusInternalServerError,
+			StatusCode: loginStatus(ctx, err),
 			Data:       nil,
 		})
 		return
@@ -95,19 +108,7 @@ func loginUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	isMatch := helpers.CheckPasswordHash(req.Password, user.Password)
-	if !isMatch {
-		helpers.CreateResponse(ctx, helpers.Response{
-			Message:    "Invalid credentials",
-			StatusCode: http.StatusBadRequest,
-			Data:       nil,
-		})
-		return
-	}
-
-	// strings.
-
-	token, err := jwt.GenerateJWT(user.Id)
+	token, err := signIn(ctx, user)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -127,8 +128,32 @@ func loginUserHandler(ctx *gin.Context) {
 	})
 }
 
+// signIn records a session for the request's device and issues a token bound to it
+func signIn(ctx *gin.Context, user *models.User) (string, error) {
+	if err := checkAccountStatus(user); err != nil {
+		return "", err
+	}
+	session, err := sessions.Create(user, ctx.Request.UserAgent(), ctx.ClientIP())
+	if err != nil {
+		return "", err
+	}
+	return jwt.GenerateSessionJWT(user.Id, session.ID)
+}
+
+func loginStatus(ctx *gin.Context, err error) int {
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(err, models.ErrSuspended) || errors.Is(err, models.ErrPasswordResetRequired) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
 func signUpAdminHandler(ctx *gin.Context) {
-	var req SignUpRequest
+	var req AdminSignUpRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -137,7 +162,15 @@ func signUpAdminHandler(ctx *gin.Context) {
 		})
 		return
 	}
-	hash, err := helpers.HashPassword(req.Password, 8)
+	if err := passwords.Validate(req.Password, req.FirstName, req.LastName); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+	hash, err := passwords.Hash(req.Password)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -146,17 +179,17 @@ func signUpAdminHandler(ctx *gin.Context) {
 		})
 		return
 	}
+
 	newUser := models.User{
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
-		Email:     req.Email,
-		RoleName:  models.AdminRole,
 		Password:  hash,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	result, err := createUser(newUser)
+	// the email and role come from the invite
+	result, err := acceptInvite(req.Token, newUser)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -173,6 +206,99 @@ func signUpAdminHandler(ctx *gin.Context) {
 	})
 }
 
+func createInviteHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	var req InviteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	expiresIn := 72 * time.Hour
+	if req.ExpiresInHours != 0 {
+		expiresIn = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	invite, token, err := createInvite(models.AuditActorFromContext(ctx), req.Email, models.Role(req.Role), user, expiresIn)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := sendInvite(invite, token); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully sent invite",
+		StatusCode: http.StatusOK,
+		Data:       invite,
+	})
+}
+
+func getInvitesHandler(ctx *gin.Context) {
+	invites, total, page, perPage, err := getInvites(ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched invites",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     invites,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func revokeInviteHandler(ctx *gin.Context) {
+	err := revokeInvite(models.AuditActorFromContext(ctx), ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully revoked invite",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
+
 func loginAdminHandler(ctx *gin.Context) {
 	var req LoginRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -183,17 +309,18 @@ func loginAdminHandler(ctx *gin.Context) {
 		})
 		return
 	}
-	user, err := getUserByEmail(req.Email)
+	user, err := authenticate(req.Email, req.Password, ctx.ClientIP())
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
-			StatusCode: http.StatusInternalServerError,
+			StatusCode: loginStatus(ctx, err),
 			Data:       nil,
 		})
 		return
 	}
 
-	if user.RoleName != models.AdminRole && user.RoleName != models.SuperAdminRole {
+	// every role other than fans is staff and signs in through the admin flow
+	if user.RoleName == models.UserRole {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    "you don't have permission to access this resource",
 			StatusCode: http.StatusUnauthorized,
@@ -202,17 +329,14 @@ func loginAdminHandler(ctx *gin.Context) {
 		return
 	}
 
-	isMatch := helpers.CheckPasswordHash(req.Password, user.Password)
-	if !isMatch {
+	if err := sendOtp(user, emails.OTPLogin); err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
-			Message:    "Invalid password",
-			StatusCode: http.StatusBadRequest,
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
 			Data:       nil,
 		})
 		return
 	}
-	// send the otp in a seperate thread
-	go sendOtp(user, "Please confirm login")
 
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully sent otp",
@@ -240,7 +364,7 @@ func confirmLoginAdminHandler(ctx *gin.Context) {
 		})
 		return
 	}
-	token, err := jwt.GenerateJWT(user.Id)
+	token, err := signIn(ctx, user)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -258,7 +382,7 @@ func confirmLoginAdminHandler(ctx *gin.Context) {
 		Data:       token,
 	})
 
-	go destroyToken(user.Id)
+	events.PublishCommitted(events.VerificationTokenUsed{UserID: user.Id})
 }
 
 func forgotPasswordHandler(ctx *gin.Context) {
@@ -272,18 +396,8 @@ func forgotPasswordHandler(ctx *gin.Context) {
 		return
 	}
 
-	user, err := getUserByEmail(req.Email)
-	if err != nil {
-		helpers.CreateResponse(ctx, helpers.Response{
-			Message:    err.Error(),
-			StatusCode: http.StatusInternalServerError,
-			Data:       nil,
-		})
-		return
-	}
-
-	// send the otp in a seperate thread
-	go sendOtp(user, "Reset Password")
+	// respond the same way, and as fast, whether or not the email is registered
+	go sendResetOtp(req.Email)
 
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "Successfully sent mail",
@@ -320,7 +434,7 @@ func resetPasswordHandler(ctx *gin.Context) {
 		})
 		return
 	}
-	go destroyToken(user.Id)
+	events.PublishCommitted(events.VerificationTokenUsed{UserID: user.Id})
 
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "Successfully changed password",
@@ -328,3 +442,118 @@ func resetPasswordHandler(ctx *gin.Context) {
 		Data:       nil,
 	})
 }
+
+func oidcLoginHandler(ctx *gin.Context) {
+	authURL, err := beginOIDCLogin(ctx.Param("provider"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+	ctx.Redirect(http.StatusFound, authURL)
+}
+
+func oidcCallbackHandler(ctx *gin.Context) {
+	if reason := ctx.Query("error"); reason != "" {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    "sign in was not completed: " + reason,
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	code, state := ctx.Query("code"), ctx.Query("state")
+	if code == "" || state == "" {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    "code and state are required",
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	user, err := completeOIDCLogin(ctx.Param("provider"), code, state)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusUnauthorized,
+			Data:       nil,
+		})
+		return
+	}
+
+	token, err := signIn(ctx, user)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully signed in",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"token": token,
+			"user":  user,
+		},
+	})
+}
+
+func magicLinkHandler(ctx *gin.Context) {
+	var req MagicLinkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	// respond the same way, and as fast, whether or not the email is registered
+	go sendMagicLink(req.Email)
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "Successfully sent mail",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
+
+func verifyMagicLinkHandler(ctx *gin.Context) {
+	user, err := redeemMagicLink(ctx.Query("token"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusUnauthorized,
+			Data:       nil,
+		})
+		return
+	}
+
+	token, err := signIn(ctx, user)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully signed in",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"token": token,
+			"user":  user,
+		},
+	})
+}
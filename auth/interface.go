@@ -29,4 +29,20 @@ type Otp struct {
 
 type ForgotPasswordRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-}
\ No newline at end of file
+}
+type AdminSignUpRequest struct {
+	FirstName string `json:"first_name" binding:"required,min=3"`
+	LastName  string `json:"last_name" binding:"required,min=3"`
+	Password  string `json:"password" binding:"required,min=5"`
+	Token     string `json:"token" binding:"required"`
+}
+
+type InviteRequest struct {
+	Email          string `json:"email" binding:"required,email"`
+	Role           string `json:"role" binding:"required"`
+	ExpiresInHours int    `json:"expires_in_hours" binding:"omitempty,min=1,max=720"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
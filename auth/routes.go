@@ -2,6 +2,10 @@ package auth
 
 import (
 	"github.com/gin-gonic/gin"
+
+	"league/jwt"
+	"league/middleware"
+	"league/models"
 )
 
 func AuthRoutes(superRoute *gin.RouterGroup) {
@@ -14,5 +18,17 @@ func AuthRoutes(superRoute *gin.RouterGroup) {
 		authRouter.POST("/admin/login/confirm", confirmLoginAdminHandler)
 		authRouter.POST("/forgot-password", forgotPasswordHandler)
 		authRouter.POST("/reset-password", resetPasswordHandler)
+		authRouter.POST("/magic-link", magicLinkHandler)
+		authRouter.GET("/magic-link/verify", verifyMagicLinkHandler)
+		authRouter.GET("/oidc/:provider/login", oidcLoginHandler)
+		authRouter.GET("/oidc/:provider/callback", oidcCallbackHandler)
+	}
+
+	inviteRouter := authRouter.Group("/admin/invites")
+	{
+		inviteRouter.Use(jwt.Middleware())
+		inviteRouter.POST("/", middleware.RequirePermission(models.InvitesWrite), createInviteHandler)
+		inviteRouter.GET("/", middleware.RequirePermission(models.InvitesWrite), getInvitesHandler)
+		inviteRouter.DELETE("/:id", middleware.RequirePermission(models.InvitesWrite), revokeInviteHandler)
 	}
 }
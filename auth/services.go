@@ -5,20 +5,34 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"league/db" //remove during unit tests
 	"league/emails" //remove during unit tests
+	"league/events"
 	"league/helpers"
+	"league/jwt"
 	"league/models"
+	"league/oidc"
+	"league/passwords"
+	cisredis "league/redis"
+	"league/roles"
+	"league/sessions"
 
 	mrand "math/rand"
 
-	
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 
 	"context"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"strings"
@@ -28,8 +42,10 @@ var adminFirstName string
 var adminLastName string
 var adminEmail string
 var adminPassword string
+var appURL string
 
 var userCollection *mongo.Collection = db.GetCollection(db.MongoClient, "users")
+var inviteCollection *mongo.Collection = db.GetCollection(db.MongoClient, "invites")
 var duration time.Duration = 10 * time.Second
 // var userCollection *mongo.Collection  //this is for testing
 
@@ -48,6 +64,39 @@ func init() {
 		}
 	}
 
+	//check for invite token index
+	inviteExists, err := db.IsIndexExists(context.Background(), inviteCollection, "token_hash")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !inviteExists {
+		err = db.IndexField(*inviteCollection, "token_hash", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	//check for linked identity index
+	identityExists, err := db.IsIndexExists(context.Background(), userCollection, "identities.subject")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !identityExists {
+		err = db.IndexSparse(*userCollection, "identities.subject", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	appURL = os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:8000"
+	}
+
 	// err = godotenv.Load()
 	// if err != nil {
 	// 	log.Println("Error loading .env file")
@@ -71,7 +120,7 @@ func createAdmin() {
 	var user models.User
 	err := userCollection.FindOne(ctx, bson.M{"email": strings.ToLower(adminEmail)}).Decode(&user)
 	if err != nil {
-		hash, _ := helpers.HashPassword(adminPassword, 8)
+		hash, _ := passwords.Hash(adminPassword)
 		if err == mongo.ErrNoDocuments {
 			newUser := models.User{
 				FirstName: adminFirstName,
@@ -96,9 +145,13 @@ func createAdmin() {
 }
 
 func createUser(user models.User) (*models.User, error) {
-	user.SetEmail()
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
+	return insertUser(ctx, user)
+}
+
+func insertUser(ctx context.Context, user models.User) (*models.User, error) {
+	user.SetEmail()
 	result, err := userCollection.InsertOne(ctx, user)
 	if err != nil {
 		//check for duplicates
@@ -115,7 +168,7 @@ func createUser(user models.User) (*models.User, error) {
 	err = userCollection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&insertedUser)
 	if err != nil {
 		// Handle error
-		return nil, fmt.Errorf("failed to fetch inserted user: %v", err)
+		return nil, fmt.Errorf("failed to fetch inserted user: %w", err)
 	}
 
 	return &insertedUser, nil
@@ -125,7 +178,7 @@ func getUserByEmail(email string) (*models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 	var user models.User
-	err := userCollection.FindOne(ctx, bson.M{"email": strings.ToLower(email)}).Decode(&user)
+	err := userCollection.FindOne(ctx, db.NotDeleted(bson.M{"email": strings.ToLower(email)})).Decode(&user)
 	if err != nil {
 		// Handle error
 		if err == mongo.ErrNoDocuments {
@@ -156,7 +209,8 @@ func GenerateOtp(length int) string {
 	return StringWithCharset(length, charset)
 }
 
-func sendOtp(user *models.User, title string) {
+// sendOtp stores a fresh one-time code and mails it; purpose picks the subject, see emails.OTPLogin
+func sendOtp(user *models.User, purpose string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 	otp := GenerateOtp(4)
@@ -165,17 +219,60 @@ func sendOtp(user *models.User, title string) {
 
 	_, err := userCollection.UpdateOne(ctx, bson.M{"_id": user.Id}, bson.M{"$set": update})
 	if err != nil {
-		fmt.Printf("could not update user: %v \n", err)
-		return
+		return fmt.Errorf("could not update user: %v", err)
+	}
+	// a new code gets a fresh set of attempts
+	if err := cisredis.Delete(otpFailKey(user.Id)); err != nil {
+		return err
 	}
 
-	//remove unit tests
-	err = emails.SendOTPEmail(user.Email, otp, title)
+	// queued in the outbox, the workers deliver it
+	if err := emails.SendOTPEmail(user.Email, user.Locale, otp, purpose); err != nil {
+		return fmt.Errorf("could not send email: %v", err)
+	}
+	return nil
+}
+
+// sendResetOtp mails a password reset code to a registered address; other addresses are silently ignored
+func sendResetOtp(email string) {
+	user, err := getUserByEmail(email)
 	if err != nil {
-		fmt.Printf("could not send email: %v \n", err)
 		return
 	}
-	fmt.Printf("successfully sent otp %v \n", otp)
+	if err := sendOtp(user, emails.OTPResetPassword); err != nil {
+		fmt.Printf("could not send reset otp: %v \n", err)
+	}
+}
+
+// a code has 10,000 values, so it is destroyed after a few wrong guesses
+const maxOtpFailures = 5
+
+var ErrTooManyOtpFailures = errors.New("too many wrong codes, request a new one")
+
+func otpFailKey(ID primitive.ObjectID) string {
+	return "otp:fail:" + ID.Hex()
+}
+
+// checkOtp compares a one-time code with the user's, counting wrong guesses against the code
+func checkOtp(user *models.User, otp string) error {
+	if user.VerificationToken != "" && subtle.ConstantTimeCompare([]byte(user.VerificationToken), []byte(otp)) == 1 {
+		return cisredis.Delete(otpFailKey(user.Id))
+	}
+
+	failures, err := cisredis.Increment(otpFailKey(user.Id), 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	if failures >= maxOtpFailures {
+		if err := destroyToken(user.Id); err != nil {
+			return err
+		}
+		if err := cisredis.Delete(otpFailKey(user.Id)); err != nil {
+			return err
+		}
+		return ErrTooManyOtpFailures
+	}
+	return fmt.Errorf("invalid verification token")
 }
 
 func getUserFromOtp(otp string, email string) (*models.User, error) {
@@ -189,7 +286,7 @@ func getUserFromOtp(otp string, email string) (*models.User, error) {
 			"$gt": time.Now(),
 		},
 	}
-	err := userCollection.FindOne(ctx, filter).Decode(&user)
+	err := userCollection.FindOne(ctx, db.NotDeleted(filter)).Decode(&user)
 	if err != nil {
 		// Handle error
 		if err == mongo.ErrNoDocuments {
@@ -200,30 +297,30 @@ func getUserFromOtp(otp string, email string) (*models.User, error) {
 		return nil, fmt.Errorf("failed to fetch user by token: %v", err)
 	}
 
-	if user.VerificationToken != otp {
-		return nil, fmt.Errorf("invalid verification token")
+	if err := checkOtp(&user, otp); err != nil {
+		return nil, err
 	}
 
 	return &user, nil
 }
 
-func destroyToken(ID primitive.ObjectID) {
+// destroyToken clears a spent one time password, it runs once VerificationTokenUsed is published
+func destroyToken(ID primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 	update := bson.M{"verification_token": "", "expires_at": time.Time{}, "updated_at": time.Now()}
 	_, err := userCollection.UpdateOne(ctx, bson.M{"_id": ID}, bson.M{"$set": update})
 	if err != nil {
-		fmt.Printf("could not update user: %v \n", err)
-		return
+		return fmt.Errorf("could not update user: %v", err)
 	}
-	fmt.Printf("destroyed user token %v \n", ID)
+	return nil
 }
 
 func forgotPassword(email string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 	var user models.User
-	err := userCollection.FindOne(ctx, bson.M{"email": strings.ToLower(email)}).Decode(&user)
+	err := userCollection.FindOne(ctx, db.NotDeleted(bson.M{"email": strings.ToLower(email)})).Decode(&user)
 	if err != nil {
 		// Handle error
 		if err == mongo.ErrNoDocuments {
@@ -247,7 +344,7 @@ func getUser(otp string, email string) (*models.User, error) {
 			"$gt": time.Now(),
 		},
 	}
-	err := userCollection.FindOne(ctx, filter).Decode(&user)
+	err := userCollection.FindOne(ctx, db.NotDeleted(filter)).Decode(&user)
 	if err != nil {
 		// Handle error
 		if err == mongo.ErrNoDocuments {
@@ -258,31 +355,615 @@ func getUser(otp string, email string) (*models.User, error) {
 		return nil, fmt.Errorf("failed to fetch user by token: %v", err)
 	}
 
-	if user.VerificationToken != otp {
-		return nil, fmt.Errorf("invalid verification token")
+	if err := checkOtp(&user, otp); err != nil {
+		return nil, err
 	}
 
 	return &user, nil
 }
 
+// changePassword resets a forgotten password and signs the user out everywhere, in case someone else had it
 func changePassword(ID primitive.ObjectID, password string) error {
+	err := passwords.Set(ID, password)
+	if err != nil {
+		fmt.Printf("could not update user: %v \n", err)
+		return err
+	}
+	return sessions.RevokeAll(ID)
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// only the hash of a token is persisted so a leaked collection cannot be redeemed
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+var ErrPrivilegedInvite = fmt.Errorf("only super-admins can invite super-admins or roles with privileged permissions")
+
+// createInvite checks the inviter may hand out the role, since accepting the invite grants it without further review
+func createInvite(actor models.AuditActor, email string, role models.Role, inviter *models.User, expiresIn time.Duration) (*models.Invite, string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
-	hash, err := helpers.HashPassword(password, 8)
+	if role == models.UserRole {
+		return nil, "", fmt.Errorf("fans sign up themselves and cannot be invited")
+	}
+	if role == models.SuperAdminRole && inviter.RoleName != models.SuperAdminRole {
+		return nil, "", ErrPrivilegedInvite
+	}
+	definition, err := roles.GetRole(role)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	update := bson.M{
-		"password":   hash,
-		"updated_at": time.Now(),
+	if models.IsPrivileged(definition.Permissions) && inviter.RoleName != models.SuperAdminRole {
+		return nil, "", ErrPrivilegedInvite
 	}
-	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": ID}, bson.M{"$set": update})
+
+	email = strings.ToLower(email)
+	count, err := userCollection.CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch user: %v", err)
+	}
+	if count > 0 {
+		return nil, "", fmt.Errorf("email already exists: %s", email)
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	invite := models.Invite{
+		Email:     email,
+		RoleName:  role,
+		TokenHash: hashToken(token),
+		Status:    models.InvitePending,
+		InvitedBy: inviter.Id,
+		ExpiresAt: time.Now().Add(expiresIn),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	// a new invite supersedes any pending one for the same address, so there is never more than one
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		_, err := inviteCollection.UpdateMany(ctx,
+			bson.M{"email": email, "status": models.InvitePending},
+			bson.M{"$set": bson.M{"status": models.InviteRevoked, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not revoke previous invites: %w", err)
+		}
+
+		result, err := inviteCollection.InsertOne(ctx, invite)
+		if err != nil {
+			return fmt.Errorf("could not create invite: %w", err)
+		}
+		invite.ID = result.InsertedID.(primitive.ObjectID)
+		return events.PublishInTransaction(ctx, events.InviteCreated{Actor: actor, Invite: invite})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	events.PublishCommitted(events.InviteCreated{Actor: actor, Invite: invite})
+	return &invite, token, nil
+}
+
+func sendInvite(invite *models.Invite, token string) error {
+	link := fmt.Sprintf("%s/admin/signup?token=%s", strings.TrimRight(appURL, "/"), token)
+	if err := emails.SendInviteEmail(invite.Email, emails.DefaultLocale, link, string(invite.RoleName)); err != nil {
+		return fmt.Errorf("could not send invite: %v", err)
+	}
+	return nil
+}
+
+func getInvites(pageNumber string, pageSize string) ([]models.Invite, int64, int64, int64, error) {
+	perPage := int64(15)
+	page := int64(1)
+
+	if pageSize != "" {
+		if perPageNum, err := strconv.Atoi(pageSize); err == nil {
+			perPage = int64(perPageNum)
+		}
+	}
+
+	if pageNumber != "" {
+		if num, err := strconv.Atoi(pageNumber); err == nil {
+			page = int64(num)
+		}
+	}
+
+	offset := (page - 1) * perPage
+
+	filter := bson.M{
+		"status":     models.InvitePending,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	fOpt := options.FindOptions{Limit: &perPage, Skip: &offset, Sort: bson.D{{Key: "created_at", Value: -1}}}
+
+	total, err := inviteCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to count invites: %v", err)
+	}
+
+	cursor, err := inviteCollection.Find(ctx, filter, &fOpt)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to find invites: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	invites := make([]models.Invite, 0)
+	if err := cursor.All(ctx, &invites); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to decode invites: %v", err)
+	}
+
+	return invites, total, page, perPage, nil
+}
+
+func revokeInvite(actor models.AuditActor, ID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	var before, after models.Invite
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		err := inviteCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": objID, "status": models.InvitePending},
+			bson.M{"$set": bson.M{"status": models.InviteRevoked, "updated_at": time.Now()}},
+		).Decode(&before)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("no pending invite found with ID %s", ID)
+			}
+			return fmt.Errorf("could not revoke invite: %w", err)
+		}
+		if err := inviteCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&after); err != nil {
+			return fmt.Errorf("failed to fetch invite: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.InviteRevoked{Actor: actor, Before: before, After: after})
+	})
 	if err != nil {
-		fmt.Printf("could not update user: %v \n", err)
 		return err
 	}
+
+	events.PublishCommitted(events.InviteRevoked{Actor: actor, Before: before, After: after})
 	return nil
 }
 
+// acceptInvite creates the invited account; the invite is only spent when the account is created
+func acceptInvite(token string, user models.User) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
 
+	var created *models.User
+	err := db.Transaction(ctx, func(ctx context.Context) error {
+		invite, err := redeemInvite(ctx, token)
+		if err != nil {
+			return err
+		}
+		user.Email = invite.Email
+		user.RoleName = invite.RoleName
+		created, err = insertUser(ctx, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// redeemInvite atomically marks a valid invite as accepted so it cannot be used twice
+func redeemInvite(ctx context.Context, token string) (*models.Invite, error) {
+	filter := bson.M{
+		"token_hash": hashToken(token),
+		"status":     models.InvitePending,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	update := bson.M{"$set": bson.M{"status": models.InviteAccepted, "updated_at": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var invite models.Invite
+	err := inviteCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&invite)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("invite is invalid or has expired")
+		}
+		return nil, fmt.Errorf("failed to fetch invite: %w", err)
+	}
+	return &invite, nil
+}
+
+const (
+	maxAccountFailures = 5
+	maxIPFailures      = 20
+	failureWindow      = 15 * time.Minute
+	baseLockout        = time.Minute
+	maxLockout         = 24 * time.Hour
+)
+
+var ErrInvalidCredentials = fmt.Errorf("invalid email or password")
+
+// compared against when the email is unknown so both paths cost one bcrypt check
+var dummyHash, _ = passwords.Hash("league-dummy-password")
+
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, try again in %v", e.RetryAfter.Round(time.Second))
+}
+
+func lockKey(kind string, value string) string {
+	return fmt.Sprintf("login:lock:%s:%s", kind, strings.ToLower(value))
+}
+
+func failKey(kind string, value string) string {
+	return fmt.Sprintf("login:fail:%s:%s", kind, strings.ToLower(value))
+}
+
+func strikeKey(kind string, value string) string {
+	return fmt.Sprintf("login:strikes:%s:%s", kind, strings.ToLower(value))
+}
+
+// checkLockout returns a LockedError while either the account or the client ip is locked
+func checkLockout(email string, ip string) error {
+	for _, key := range []string{lockKey("account", email), lockKey("ip", ip)} {
+		ttl, err := cisredis.TimeToLive(key)
+		if err != nil {
+			return err
+		}
+		if ttl > 0 {
+			return &LockedError{RetryAfter: ttl}
+		}
+	}
+	return nil
+}
+
+// lock applies an exponentially growing lock: every repeated lockout within a day doubles it
+func lock(kind string, value string) (time.Duration, error) {
+	strikes, err := cisredis.Increment(strikeKey(kind, value), maxLockout)
+	if err != nil {
+		return 0, err
+	}
+	lockout := baseLockout << uint(strikes-1)
+	if lockout > maxLockout || lockout <= 0 {
+		lockout = maxLockout
+	}
+	if err := cisredis.Store(lockKey(kind, value), strikes, lockout); err != nil {
+		return 0, err
+	}
+	if err := cisredis.Delete(failKey(kind, value)); err != nil {
+		return 0, err
+	}
+	return lockout, nil
+}
+
+// recordFailedLogin counts a failed attempt and locks the account or ip once over the limit
+func recordFailedLogin(email string, ip string, user *models.User) {
+	failures, err := cisredis.Increment(failKey("account", email), failureWindow)
+	if err != nil {
+		fmt.Printf("could not record failed login: %v \n", err)
+		return
+	}
+	if failures >= maxAccountFailures {
+		lockout, err := lock("account", email)
+		if err != nil {
+			fmt.Printf("could not lock account: %v \n", err)
+			return
+		}
+		if user != nil {
+			sendLockedEmail(user.Email, user.Locale, time.Now().Add(lockout))
+		}
+	}
+
+	ipFailures, err := cisredis.Increment(failKey("ip", ip), failureWindow)
+	if err != nil {
+		fmt.Printf("could not record failed login: %v \n", err)
+		return
+	}
+	if ipFailures >= maxIPFailures {
+		if _, err := lock("ip", ip); err != nil {
+			fmt.Printf("could not lock ip: %v \n", err)
+		}
+	}
+}
+
+func sendLockedEmail(email string, locale string, until time.Time) {
+	if err := emails.SendAccountLockedEmail(email, locale, until); err != nil {
+		fmt.Printf("could not send email: %v \n", err)
+	}
+}
+
+func clearFailedLogins(email string) {
+	for _, key := range []string{failKey("account", email), strikeKey("account", email)} {
+		if err := cisredis.Delete(key); err != nil {
+			fmt.Printf("could not clear failed logins: %v \n", err)
+		}
+	}
+}
+
+// authenticate checks credentials without revealing whether the email is registered
+func authenticate(email string, password string, ip string) (*models.User, error) {
+	if err := checkLockout(email, ip); err != nil {
+		return nil, err
+	}
+
+	user, err := getUserByEmail(email)
+	if err != nil {
+		helpers.CheckPasswordHash(password, dummyHash)
+		recordFailedLogin(email, ip, nil)
+		return nil, ErrInvalidCredentials
+	}
+
+	if !helpers.CheckPasswordHash(password, user.Password) {
+		recordFailedLogin(email, ip, user)
+		return nil, ErrInvalidCredentials
+	}
+
+	clearFailedLogins(email)
+
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
+	}
+
+	// upgrade hashes made with an older, cheaper cost now that we know the password
+	if passwords.NeedsRehash(user.Password) {
+		go rehashPassword(user.Id, password)
+	}
+	return user, nil
+}
+
+// how long a user has to complete the sign in at the provider
+var oidcStateTTL time.Duration = 10 * time.Minute
+
+type oidcState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func oidcStateKey(state string) string {
+	return "oidc:state:" + state
+}
+
+// beginOIDCLogin remembers the state, nonce and PKCE verifier and returns the provider's authorization url
+func beginOIDCLogin(providerName string) (string, error) {
+	provider, err := oidc.GetProvider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		return "", err
+	}
+	pkce, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := json.Marshal(oidcState{Provider: provider.Name, Nonce: nonce, Verifier: pkce.Verifier})
+	if err != nil {
+		return "", err
+	}
+	if err := cisredis.Store(oidcStateKey(state), value, oidcStateTTL); err != nil {
+		return "", err
+	}
+
+	return provider.AuthCodeURL(state, nonce, pkce.Challenge)
+}
+
+// completeOIDCLogin redeems the callback's code and resolves the signed in user
+func completeOIDCLogin(providerName string, code string, state string) (*models.User, error) {
+	value, err := cisredis.Retrieve(oidcStateKey(state))
+	if err != nil {
+		return nil, errors.New("sign in request is invalid or has expired")
+	}
+	// a state can only be used once, of two callbacks racing for it only the one that deletes it goes on
+	unused, err := cisredis.Consume(oidcStateKey(state))
+	if err != nil {
+		return nil, err
+	}
+	if !unused {
+		return nil, errors.New("sign in request is invalid or has expired")
+	}
+
+	var saved oidcState
+	if err := json.Unmarshal([]byte(value), &saved); err != nil {
+		return nil, fmt.Errorf("failed to decode sign in request: %v", err)
+	}
+
+	provider, err := oidc.GetProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	if saved.Provider != provider.Name {
+		return nil, errors.New("sign in request was started with a different provider")
+	}
+
+	token, err := provider.Exchange(code, saved.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.VerifyIDToken(token.IDToken, saved.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return findOrCreateOIDCUser(provider.Name, claims)
+}
+
+var ErrStaffOIDCLogin = errors.New("staff accounts must sign in through the admin flow")
+
+// findOrCreateOIDCUser returns the linked user, links an existing fan by verified email or creates a new fan
+func findOrCreateOIDCUser(provider string, claims *oidc.Claims) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, db.NotDeleted(bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": claims.Subject}},
+	})).Decode(&user)
+	if err == nil {
+		// a fan promoted since the identity was linked must now go through the admin one-time code
+		if user.RoleName != models.UserRole {
+			return nil, ErrStaffOIDCLogin
+		}
+		return &user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	// without a verified email we can neither link nor create an account safely
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errors.New("your provider did not share a verified email address")
+	}
+
+	identity := models.Identity{Provider: provider, Subject: claims.Subject, LinkedAt: time.Now()}
+
+	existing, err := getUserByEmail(claims.Email)
+	if err == nil {
+		if existing.RoleName != models.UserRole {
+			return nil, ErrStaffOIDCLogin
+		}
+		_, err = userCollection.UpdateOne(ctx,
+			bson.M{"_id": existing.Id},
+			bson.M{
+				"$push": bson.M{"identities": identity},
+				"$set":  bson.M{"updated_at": time.Now()},
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not link account: %v", err)
+		}
+		existing.Identities = append(existing.Identities, identity)
+		return existing, nil
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		parts := strings.SplitN(strings.TrimSpace(claims.Name), " ", 2)
+		firstName = parts[0]
+		if len(parts) == 2 {
+			lastName = parts[1]
+		}
+	}
+
+	// accounts created through a provider have no password
+	return createUser(models.User{
+		FirstName:  firstName,
+		LastName:   lastName,
+		Email:      claims.Email,
+		RoleName:   models.UserRole,
+		Identities: []models.Identity{identity},
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	})
+}
+
+const magicLinkPurpose = "magic-link"
+
+var magicLinkTTL time.Duration = 15 * time.Minute
+
+// at most this many links are mailed to one address per ttl window
+const maxMagicLinks = 5
+
+func magicLinkKey(jti string) string {
+	return "magic-link:" + jti
+}
+
+// sendMagicLink mails a sign in link to a fan; other addresses are silently ignored
+func sendMagicLink(email string) {
+	user, err := getUserByEmail(email)
+	if err != nil || user.RoleName != models.UserRole {
+		return
+	}
+
+	sent, err := cisredis.Increment("magic-link:sent:"+user.Email, magicLinkTTL)
+	if err != nil || sent > maxMagicLinks {
+		return
+	}
+
+	token, jti, err := jwt.GenerateLinkToken(user.Id, magicLinkPurpose, magicLinkTTL)
+	if err != nil {
+		fmt.Printf("could not create magic link: %v \n", err)
+		return
+	}
+	if err := cisredis.Store(magicLinkKey(jti), user.Id.Hex(), magicLinkTTL); err != nil {
+		return
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", strings.TrimRight(appURL, "/"), token)
+	if err := emails.SendMagicLinkEmail(user.Email, user.Locale, link, magicLinkTTL); err != nil {
+		fmt.Printf("could not send magic link: %v \n", err)
+	}
+}
+
+// redeemMagicLink verifies the link's signature and burns it so it cannot be used again
+func redeemMagicLink(token string) (*models.User, error) {
+	ID, jti, err := jwt.ParseLinkToken(token, magicLinkPurpose)
+	if err != nil {
+		return nil, err
+	}
+
+	unused, err := cisredis.Consume(magicLinkKey(jti))
+	if err != nil {
+		return nil, err
+	}
+	if !unused {
+		return nil, errors.New("this link has already been used")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": ID})).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("invalid link")
+		}
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	if user.RoleName != models.UserRole {
+		return nil, errors.New("invalid link")
+	}
+	return &user, nil
+}
+
+func rehashPassword(ID primitive.ObjectID, password string) {
+	if err := passwords.Rehash(ID, password); err != nil {
+		fmt.Printf("could not rehash password: %v \n", err)
+	}
+}
+
+// checkAccountStatus stops suspended accounts and accounts awaiting a forced password reset from signing in
+func checkAccountStatus(user *models.User) error {
+	if user.IsSuspended() {
+		return models.ErrSuspended
+	}
+	if user.PasswordResetRequired {
+		return models.ErrPasswordResetRequired
+	}
+	return nil
+}
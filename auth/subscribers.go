@@ -0,0 +1,9 @@
+package auth
+
+import (
+	"league/events"
+)
+
+func init() {
+	events.SubscribeAsync(func(e events.VerificationTokenUsed) error { return destroyToken(e.UserID) })
+}
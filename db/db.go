@@ -4,6 +4,7 @@ import (
 	// "github.com/joho/godotenv"
 
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -125,6 +126,24 @@ func IndexCompound(collection mongo.Collection, keys bson.M, indexType int) erro
 	return nil
 }
 
+// IndexUniqueCompound keeps the keys in order, the combination of values has to be unique
+func IndexUniqueCompound(collection mongo.Collection, keys bson.D) error {
+	indexModel := mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetUnique(true),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		fmt.Println("Failed to create index:", err)
+		return err
+	}
+	fmt.Printf("Index created successfully on %v fields.\n", keys)
+	return nil
+}
+
 func IndexText(collection mongo.Collection, key string) error {
 	indexModel := mongo.IndexModel{
 		Keys:    bson.M{key: "text"},
@@ -161,5 +180,30 @@ func IsIndexExists(ctx context.Context, collection *mongo.Collection, indexKey s
 	return false, nil
 }
 
+// IndexTTL removes documents once field is older than after; documents without the field are kept.
+// When the index already exists its expiry is updated, so changing the retention takes effect on restart
+func IndexTTL(collection mongo.Collection, field string, after time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
+	seconds := int32(after.Seconds())
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{field: 1},
+		Options: options.Index().SetExpireAfterSeconds(seconds),
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == indexOptionsConflict {
+		err = collection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: collection.Name()},
+			{Key: "index", Value: bson.M{"keyPattern": bson.M{field: 1}, "expireAfterSeconds": seconds}},
+		}).Err()
+	}
+	if err != nil {
+		fmt.Println("Failed to create index:", err)
+		return err
+	}
+	return nil
+}
 
+// indexOptionsConflict is returned when an index exists on the same keys with other options
+const indexOptionsConflict = 85
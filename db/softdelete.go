@@ -0,0 +1,96 @@
+package db
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// purgeInterval is how often purge workers look for documents past the retention period
+const purgeInterval = time.Hour
+
+// TrashRetention is how long soft deleted documents can be restored before they are purged,
+// TRASH_RETENTION_DAYS overrides it
+var TrashRetention time.Duration = trashRetention()
+
+func trashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// NotDeleted adds the condition every default query on a soft deleted collection needs
+func NotDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+// Deleted matches documents in the trash
+func Deleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": true}
+	return filter
+}
+
+// Expired matches documents that have been in the trash for longer than the retention period
+func Expired(now time.Time) bson.M {
+	return bson.M{"deleted_at": bson.M{"$lte": now.Add(-TrashRetention)}}
+}
+
+// TrashPage finds one page of the deleted documents matching filter, most recently deleted first, and decodes them into results;
+// it returns how many there are in total together with the page and page size it used
+func TrashPage(ctx context.Context, collection *mongo.Collection, filter bson.M, pageNumber string, pageSize string, results interface{}) (int64, int64, int64, error) {
+	perPage := int64(15)
+	page := int64(1)
+
+	if pageSize != "" {
+		if perPageNum, err := strconv.Atoi(pageSize); err == nil {
+			perPage = int64(perPageNum)
+		}
+	}
+
+	if pageNumber != "" {
+		if num, err := strconv.Atoi(pageNumber); err == nil {
+			page = int64(num)
+		}
+	}
+
+	offset := (page - 1) * perPage
+	filter = Deleted(filter)
+	fOpt := options.FindOptions{Limit: &perPage, Skip: &offset, Sort: bson.D{{Key: "deleted_at", Value: -1}}}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to count deleted %v: %v", collection.Name(), err)
+	}
+
+	cursor, err := collection.Find(ctx, filter, &fOpt)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to find deleted %v: %v", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, results); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to decode deleted %v: %v", collection.Name(), err)
+	}
+	return total, page, perPage, nil
+}
+
+// StartPurging runs purge in the background now and then every purgeInterval
+func StartPurging(purge func()) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+		for {
+			purge()
+			<-ticker.C
+		}
+	}()
+}
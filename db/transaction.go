@@ -0,0 +1,100 @@
+package db
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// transactionAttempts bounds how often a transaction, or its commit, is retried after a transient error
+const transactionAttempts = 3
+
+const (
+	transientTransactionError      = "TransientTransactionError"
+	unknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+var (
+	checkTransactions sync.Mutex
+	// checked is only set once the server has answered, a failed probe is tried again on the next transaction
+	checked      bool
+	transactions bool
+)
+
+// Transaction runs fn as one multi-document transaction and retries the whole of it when MongoDB reports a transient error.
+// Every operation in fn must use the ctx it is given to be part of the transaction, and fn may run more than once,
+// errors it returns are only retried when they wrap the driver error with %w.
+// A standalone server cannot run transactions, there fn runs on its own
+func Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !supportsTransactions(ctx) {
+		return fn(ctx)
+	}
+
+	session, err := MongoClient.StartSession()
+	if err != nil {
+		return fmt.Errorf("could not start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	for attempt := 1; ; attempt++ {
+		err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+			if err := sc.StartTransaction(); err != nil {
+				return err
+			}
+			if err := fn(sc); err != nil {
+				_ = sc.AbortTransaction(context.Background())
+				return err
+			}
+			return commit(sc)
+		})
+		if err == nil || !hasLabel(err, transientTransactionError) || attempt == transactionAttempts {
+			return err
+		}
+	}
+}
+
+// commit retries a commit whose outcome the server could not confirm, committing twice is safe
+func commit(sc mongo.SessionContext) error {
+	var err error
+	for attempt := 0; attempt < transactionAttempts; attempt++ {
+		err = sc.CommitTransaction(sc)
+		if err == nil || !hasLabel(err, unknownTransactionCommitResult) {
+			return err
+		}
+	}
+	return err
+}
+
+func hasLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
+
+// supportsTransactions asks the server once whether it is a replica set member or a mongos, the only ones with transactions
+func supportsTransactions(ctx context.Context) bool {
+	checkTransactions.Lock()
+	defer checkTransactions.Unlock()
+	if checked {
+		return transactions
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := MongoClient.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		fmt.Println("Failed to check transaction support:", err)
+		return false
+	}
+	checked = true
+	transactions = hello.SetName != "" || hello.Msg == "isdbgrid"
+	if !transactions {
+		fmt.Println("MongoDB is not a replica set, compound writes run without transactions")
+	}
+	return transactions
+}
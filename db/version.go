@@ -0,0 +1,15 @@
+package db
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// AtVersion narrows an update to the version the client last saw; documents from before versions were kept are version 0
+func AtVersion(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+		return filter
+	}
+	filter["version"] = version
+	return filter
+}
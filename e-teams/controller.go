@@ -1,6 +1,7 @@
 package teams
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -25,6 +26,15 @@ func createHandler(ctx *gin.Context) {
 		return
 	}
 
+	if user.IsClubScoped() {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    models.ErrNotClubAdmin.Error(),
+			StatusCode: http.StatusForbidden,
+			Data:       nil,
+		})
+		return
+	}
+
 	var req TeamRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
@@ -47,7 +57,7 @@ func createHandler(ctx *gin.Context) {
 		UpdatedAt:   time.Now(),
 	}
 
-	result, err := createTeam(newTeam)
+	result, err := createTeam(models.AuditActorFromContext(ctx), newTeam)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -125,6 +135,10 @@ func getSingleHandler(ctx *gin.Context) {
 		})
 		return
 	}
+	// the creator is embedded, their changes have to change the tag too
+	if helpers.NotModifiedTag(ctx, helpers.ContentETag(team.Version, team)) {
+		return
+	}
 
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully fetched team",
@@ -134,6 +148,25 @@ func getSingleHandler(ctx *gin.Context) {
 }
 
 func updateHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := checkTeamAccess(user, ctx.Param("id")); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: accessStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+
 	var req TeamRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
@@ -144,16 +177,27 @@ func updateHandler(ctx *gin.Context) {
 		return
 	}
 
-	updatedTeam, err := updateUser(ctx.Param("id"), req)
+	version, err := helpers.IfMatch(ctx)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
-			StatusCode: http.StatusBadRequest,
+			StatusCode: helpers.PreconditionStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+
+	updatedTeam, err := updateUser(models.AuditActorFromContext(ctx), ctx.Param("id"), version, req)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: helpers.PreconditionStatus(err),
 			Data:       nil,
 		})
 		return
 	}
 
+	ctx.Header("ETag", helpers.ETag(updatedTeam.Version))
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully updated team",
 		StatusCode: http.StatusOK,
@@ -162,7 +206,7 @@ func updateHandler(ctx *gin.Context) {
 }
 
 func deleteHandler(ctx *gin.Context) {
-	err := deleteTeam(ctx.Param("id"))
+	err := deleteTeam(models.AuditActorFromContext(ctx), ctx.Param("id"))
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -236,6 +280,9 @@ func getPlayerHandler(ctx *gin.Context) {
 		})
 		return
 	}
+	if helpers.NotModified(ctx, player.Version) {
+		return
+	}
 
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully fetched player",
@@ -243,3 +290,100 @@ func getPlayerHandler(ctx *gin.Context) {
 		Data:       player,
 	})
 }
+
+func updatePlayerHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	var req UpdatePlayerRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	version, err := helpers.IfMatch(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: helpers.PreconditionStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+
+	player, err := updatePlayer(user, models.AuditActorFromContext(ctx), ctx.Param("id"), version, req)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: accessStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+
+	ctx.Header("ETag", helpers.ETag(player.Version))
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully updated player",
+		StatusCode: http.StatusOK,
+		Data:       player,
+	})
+}
+
+func accessStatus(err error) int {
+	if errors.Is(err, models.ErrNotClubAdmin) {
+		return http.StatusForbidden
+	}
+	return helpers.PreconditionStatus(err)
+}
+
+func getTeamTrashHandler(ctx *gin.Context) {
+	teams, total, page, perPage, err := getTrash(ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched deleted teams",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     teams,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func undeleteTeamHandler(ctx *gin.Context) {
+	team, err := undeleteTeam(models.AuditActorFromContext(ctx), ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully restored team",
+		StatusCode: http.StatusOK,
+		Data:       team,
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	// "go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -67,7 +68,7 @@ func TestCreateTeam_Success(t *testing.T) {
 	}
 
 	// Call the createTeam function
-	resp, err := createTeam(team)
+	resp, err := createTeam(models.AuditActor{}, team)
 
 	// Assert that the function returns no error and the insertedTeam is not nil
 	assert.NoError(t, err)
@@ -101,7 +102,7 @@ func TestCreateTeam_DuplicateError(t *testing.T) {
 
 	// Attempt to create a new team with the same name and stadium
 
-	insertedTeam, err := createTeam(team)
+	insertedTeam, err := createTeam(models.AuditActor{}, team)
 
 	// Assert that the function returns an error indicating duplicate key
 	assert.Error(t, err)
@@ -143,12 +144,58 @@ func TestDeleteTeam_Success(t *testing.T) {
 
 
 	// Call the deleteTeam function
-	err := deleteTeam("66058baf3166ffd82cd5ff46")
+	err := deleteTeam(models.AuditActor{}, "66058baf3166ffd82cd5ff46")
 
 	// Assert that the function returns no error
 	assert.NoError(t, err)
 }
 
+func TestUndeleteTeam_Success(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	// a team of its own, names and stadiums are unique
+	suffix := primitive.NewObjectID().Hex()
+	created, err := createTeam(models.AuditActor{}, models.Team{
+		Name:        "trash " + suffix,
+		State:       "hudders",
+		Country:     "englan",
+		FoundedYear: 200,
+		Stadium:     "trash " + suffix,
+		Sponsor:     "three",
+		CreatedBy:   primitive.NewObjectID(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Error creating team: %v", err)
+	}
+
+	// a team that is not in the trash cannot be restored
+	_, err = undeleteTeam(models.AuditActor{}, created.ID.Hex())
+	assert.Error(t, err)
+
+	result, err := playerCollection.InsertOne(context.Background(), models.Player{Name: "trash " + suffix, TeamID: created.ID, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Error creating player: %v", err)
+	}
+
+	assert.NoError(t, deleteTeam(models.AuditActor{}, created.ID.Hex()))
+
+	team, err := undeleteTeam(models.AuditActor{}, created.ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, team.ID)
+	assert.True(t, team.DeletedAt.IsZero())
+
+	// the trash keeps the team's players, they are only unlinked when it is purged
+	var player models.Player
+	assert.NoError(t, playerCollection.FindOne(context.Background(), bson.M{"_id": result.InsertedID}).Decode(&player))
+	assert.Equal(t, created.ID, player.TeamID)
+
+	_, err = undeleteTeam(models.AuditActor{}, created.ID.Hex())
+	assert.Error(t, err)
+}
+
 func TestUpdateTeam_Success(t *testing.T) {
 	// Set up test environment
 	setupTestEnvironment(t)
@@ -165,7 +212,7 @@ func TestUpdateTeam_Success(t *testing.T) {
 	}
 
 	// Call the updateUser function
-	updatedTeam, err := updateUser("66058baf3166ffd82cd5ff46", update)
+	updatedTeam, err := updateUser(models.AuditActor{}, "66058baf3166ffd82cd5ff46", models.AnyVersion, update)
 
 	// Assert that the function returns no error and the updatedTeam is not nil
 	assert.NoError(t, err)
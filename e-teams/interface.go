@@ -40,6 +40,7 @@ type TeamWithCreator struct {
 	CreatedBy   models.User        `bson:"created_by" json:"created_by"`
 	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	Version     int64              `bson:"version" json:"version"`
 }
 
 type PlayerRequest struct {
@@ -47,3 +48,11 @@ type PlayerRequest struct {
 	Position string             `json:"position" binding:"required,min=3"`
 	TeamID   primitive.ObjectID `json:"team_id" binding:"required,min=3"`
 }
+
+type UpdatePlayerRequest struct {
+	Name     string              `json:"name" binding:"omitempty,min=3"`
+	Position string              `json:"position" binding:"omitempty,min=3"`
+	Image    string              `json:"img" binding:"omitempty"`
+	Status   models.PlayerStatus `json:"status" binding:"omitempty,oneof=active injured"`
+	TeamID   primitive.ObjectID  `json:"team_id" binding:"omitempty"`
+}
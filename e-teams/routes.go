@@ -3,24 +3,24 @@ package teams
 import (
 	"github.com/gin-gonic/gin"
 
-	"league/jwt" //remove during test
 	"league/middleware"
 	"league/models"
 )
 
-var admins []models.Role = []models.Role{models.AdminRole, models.SuperAdminRole}
-
 func TeamRoutes(superRoute *gin.RouterGroup) {
 	teamRouter := superRoute.Group("/teams")
 	{
 		teamRouter.GET("/", getHandler)
 
-		teamRouter.Use(jwt.Middleware())
-		teamRouter.POST("/", middleware.RolesMiddleware(admins), createHandler)
+		teamRouter.Use(middleware.Authenticate())
+		teamRouter.POST("/", middleware.RequirePermission(models.TeamsWrite), createHandler)
 		teamRouter.GET("/:id", getSingleHandler)
-		teamRouter.PATCH("/:id", middleware.RolesMiddleware(admins), updateHandler)
-		teamRouter.DELETE("/:id", middleware.RolesMiddleware(admins), deleteHandler)
+		teamRouter.PATCH("/:id", middleware.RequirePermission(models.TeamsWrite), updateHandler)
+		teamRouter.DELETE("/:id", middleware.RequirePermission(models.TeamsDelete), deleteHandler)
+		teamRouter.GET("/trash", middleware.RequirePermission(models.TeamsDelete), getTeamTrashHandler)
+		teamRouter.POST("/:id/restore", middleware.RequirePermission(models.TeamsDelete), undeleteTeamHandler)
 		teamRouter.GET("/players", getPlayersHandler)
 		teamRouter.GET("/players/:id", getPlayerHandler)
+		teamRouter.PATCH("/players/:id", middleware.RequirePermission(models.PlayersWrite), updatePlayerHandler)
 	}
 }
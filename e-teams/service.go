@@ -7,6 +7,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"league/db"
+	"league/events"
+	"league/integrity"
 	"league/models"
 
 	"context"
@@ -102,11 +104,22 @@ func init() {
 	}
 }
 
-func createTeam(team models.Team) (*models.Team, error) {
+func createTeam(actor models.AuditActor, team models.Team) (*models.Team, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
-	result, err := teamCollection.InsertOne(ctx, team)
+	var insertedTeam models.Team
+	err := db.Transaction(ctx, func(ctx context.Context) error {
+		result, err := teamCollection.InsertOne(ctx, team)
+		if err != nil {
+			return err
+		}
+		err = teamCollection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&insertedTeam)
+		if err != nil {
+			return fmt.Errorf("failed to fetch inserted user: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.TeamCreated{Actor: actor, Team: insertedTeam})
+	})
 	if err != nil {
 		if mongoErr, ok := err.(mongo.WriteException); ok {
 			for _, e := range mongoErr.WriteErrors {
@@ -118,13 +131,7 @@ func createTeam(team models.Team) (*models.Team, error) {
 		return nil, err
 	}
 
-	var insertedTeam models.Team
-	err = teamCollection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&insertedTeam)
-	if err != nil {
-		// Handle error
-		return nil, fmt.Errorf("failed to fetch inserted user: %v", err)
-	}
-
+	events.PublishCommitted(events.TeamCreated{Actor: actor, Team: insertedTeam})
 	return &insertedTeam, nil
 }
 
@@ -138,7 +145,7 @@ func getSingleTeam(id string) (*TeamWithCreator, error) {
 	}
 
 	pipeline := mongo.Pipeline{
-		{{"$match", bson.D{{"_id", objID}}}},
+		{{"$match", db.NotDeleted(bson.M{"_id": objID})}},
 		{{"$lookup", bson.D{
 			{"from", "users"},
 			{"localField", "created_by"},
@@ -169,7 +176,7 @@ func getSingleTeam(id string) (*TeamWithCreator, error) {
 	return &team, nil
 }
 
-func deleteTeam(ID string) error {
+func deleteTeam(actor models.AuditActor, ID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
@@ -178,19 +185,37 @@ func deleteTeam(ID string) error {
 		return fmt.Errorf("invalid ObjectID: %v", err)
 	}
 
-	result, err := teamCollection.DeleteOne(ctx, bson.M{"_id": objId})
-	if err != nil {
-		return fmt.Errorf("failed to delete team: %v", err)
-	}
+	// players, followers and club admins keep pointing at the team while it is in the trash, so a restore
+	// brings it back as it was; they are cascaded or unlinked when it is purged
+	var deleted models.Team
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		if err := integrity.CheckDelete(ctx, "teams", objId); err != nil {
+			return err
+		}
+
+		// the team goes to the trash until it is restored or purged
+		err := teamCollection.FindOneAndUpdate(ctx,
+			db.NotDeleted(bson.M{"_id": objId}),
+			bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+		).Decode(&deleted)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("no team found with ID %s", ID)
+			}
+			return fmt.Errorf("failed to delete team: %w", err)
+		}
 
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("no team found with ID %s", ID)
+		return events.PublishInTransaction(ctx, events.TeamDeleted{Actor: actor, Team: deleted})
+	})
+	if err != nil {
+		return err
 	}
 
+	events.PublishCommitted(events.TeamDeleted{Actor: actor, Team: deleted})
 	return nil
 }
 
-func updateUser(ID string, update TeamRequest) (*models.Team, error) {
+func updateUser(actor models.AuditActor, ID string, version int64, update TeamRequest) (*models.Team, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
@@ -200,6 +225,17 @@ func updateUser(ID string, update TeamRequest) (*models.Team, error) {
 		return nil, fmt.Errorf("invalid ObjectID: %v", err)
 	}
 
+	var current models.Team
+	if err := teamCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": objID})).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no team found with ID %s", ID)
+		}
+		return nil, fmt.Errorf("failed to fetch team: %v", err)
+	}
+	if version != models.AnyVersion && version != current.Version {
+		return nil, models.ErrVersionMismatch
+	}
+
 	// Create update fields
 	updates := bson.M{
 		"name":         update.Name,
@@ -212,7 +248,26 @@ func updateUser(ID string, update TeamRequest) (*models.Team, error) {
 	}
 
 	// Perform the update operation
-	_, err = teamCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": updates})
+	var team models.Team
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		result, err := teamCollection.UpdateOne(ctx,
+			db.AtVersion(db.NotDeleted(bson.M{"_id": objID}), current.Version),
+			bson.M{"$set": updates, "$inc": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return models.ErrVersionMismatch
+		}
+
+		// Fetch the updated user from the database
+		err = teamCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&team)
+		if err != nil {
+			return fmt.Errorf("failed to fetch updated user: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.TeamUpdated{Actor: actor, Before: current, Team: team})
+	})
 	if err != nil {
 		// Handle specific error types
 		if mongoErr, ok := err.(mongo.WriteException); ok {
@@ -222,15 +277,13 @@ func updateUser(ID string, update TeamRequest) (*models.Team, error) {
 				}
 			}
 		}
-		return nil, fmt.Errorf("could not update user: %v", err)
+		if err == models.ErrVersionMismatch {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not update user: %w", err)
 	}
 
-	// Fetch the updated user from the database
-	var team models.Team
-	err = teamCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&team)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch updated user: %v", err)
-	}
+	events.PublishCommitted(events.TeamUpdated{Actor: actor, Before: current, Team: team})
 	return &team, nil
 }
 
@@ -252,7 +305,7 @@ func getTeam(filters TeamQueryRequest, pageNumber string, pageSize string) ([]mo
 
 	offset := (page - 1) * perPage
 
-	filter := bson.M{}
+	filter := db.NotDeleted(bson.M{})
 	if filters.Query != "" {
 		filter["$or"] = bson.A{
 			bson.M{"name": bson.M{"$regex":  filters.Query, "$options": "i"}},
@@ -378,3 +431,95 @@ func getSinglePlayer(ID string) (*models.Player, error) {
 
 	return &player, nil
 }
+
+// checkTeamAccess makes sure club admins only touch the clubs they administer
+func checkTeamAccess(user *models.User, ID string) error {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return fmt.Errorf("invalid ObjectID: %v", err)
+	}
+	if !user.ManagesTeam(objID) {
+		return models.ErrNotClubAdmin
+	}
+	return nil
+}
+
+func updatePlayer(user *models.User, actor models.AuditActor, ID string, version int64, update UpdatePlayerRequest) (*models.Player, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	var player models.Player
+	err = playerCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&player)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no player found with ID %s", ID)
+		}
+		return nil, fmt.Errorf("failed to fetch player: %v", err)
+	}
+
+	if !user.ManagesTeam(player.TeamID) {
+		return nil, models.ErrNotClubAdmin
+	}
+	if version != models.AnyVersion && version != player.Version {
+		return nil, models.ErrVersionMismatch
+	}
+
+	updates := bson.M{
+		"updated_at": time.Now(),
+	}
+	if update.Name != "" {
+		updates["name"] = update.Name
+	}
+	if update.Position != "" {
+		updates["position"] = update.Position
+	}
+	if update.Image != "" {
+		updates["img"] = update.Image
+	}
+	if update.Status != "" {
+		updates["status"] = update.Status
+	}
+	if update.TeamID != primitive.NilObjectID && update.TeamID != player.TeamID {
+		// club admins cannot move players into or out of their club
+		if user.IsClubScoped() {
+			return nil, models.ErrNotClubAdmin
+		}
+		updates["team_id"] = update.TeamID
+	}
+
+	// a player only moves to a team that is not being deleted at the same time
+	current := player
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		if teamID, ok := updates["team_id"].(primitive.ObjectID); ok {
+			if err := integrity.Require(ctx, "teams", teamID); err != nil {
+				return err
+			}
+		}
+		result, err := playerCollection.UpdateOne(ctx,
+			db.AtVersion(bson.M{"_id": objID}, player.Version),
+			bson.M{"$set": updates, "$inc": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not update player: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return models.ErrVersionMismatch
+		}
+		err = playerCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&player)
+		if err != nil {
+			return fmt.Errorf("failed to fetch updated player: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.PlayerUpdated{Actor: actor, Before: current, After: player})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events.PublishCommitted(events.PlayerUpdated{Actor: actor, Before: current, After: player})
+	return &player, nil
+}
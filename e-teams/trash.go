@@ -0,0 +1,102 @@
+package teams
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/events"
+	"league/integrity"
+	"league/models"
+
+	"context"
+	"fmt"
+	"time"
+)
+
+// getTrash lists deleted teams that can still be restored, most recently deleted first
+func getTrash(pageNumber string, pageSize string) ([]models.Team, int64, int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	teams := make([]models.Team, 0)
+	total, page, perPage, err := db.TrashPage(ctx, teamCollection, bson.M{}, pageNumber, pageSize, &teams)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+	return teams, total, page, perPage, nil
+}
+
+// undeleteTeam takes a team back out of the trash
+func undeleteTeam(actor models.AuditActor, ID string) (*models.Team, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var team models.Team
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		err := teamCollection.FindOneAndUpdate(ctx,
+			db.Deleted(bson.M{"_id": objID}),
+			bson.M{"$unset": bson.M{"deleted_at": ""}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&team)
+		if err != nil {
+			return err
+		}
+		return events.PublishInTransaction(ctx, events.TeamUndeleted{Actor: actor, Team: team})
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no deleted team found with ID %s", ID)
+		}
+		return nil, fmt.Errorf("could not restore team: %v", err)
+	}
+
+	events.PublishCommitted(events.TeamUndeleted{Actor: actor, Team: team})
+	return &team, nil
+}
+
+// purgeTrash permanently removes teams once they have outlived the retention period; only then are their players,
+// followers and club admins cascaded or unlinked as their relations say
+func purgeTrash() {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	cursor, err := teamCollection.Find(ctx, db.Expired(time.Now()), options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		fmt.Printf("failed to find expired teams: %v \n", err)
+		return
+	}
+	var expired []models.Team
+	if err := cursor.All(ctx, &expired); err != nil {
+		fmt.Printf("failed to decode expired teams: %v \n", err)
+		return
+	}
+
+	// each team and whatever its relations cascade to or unlink go together, or not at all
+	for _, team := range expired {
+		err := db.Transaction(ctx, func(ctx context.Context) error {
+			if err := integrity.ApplyDelete(ctx, "teams", team.ID); err != nil {
+				return err
+			}
+			if _, err := teamCollection.DeleteOne(ctx, bson.M{"_id": team.ID}); err != nil {
+				return fmt.Errorf("failed to purge team: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("failed to purge team %v: %v \n", team.ID.Hex(), err)
+		}
+	}
+}
+
+// StartPurgeWorker periodically removes teams that have been in the trash past the retention period
+func StartPurgeWorker() {
+	db.StartPurging(purgeTrash)
+}
@@ -1,78 +1,259 @@
 package emails
 
 import (
-	"bytes"
-	"fmt"
-	"html/template"
 	"log"
-	"net/smtp"
 	"os"
+	"time"
 	// "github.com/joho/godotenv"
 )
 
-var Auth smtp.Auth
-var user string
-
 func init() {
 	// err := godotenv.Load()
 	// if err != nil {
 	// 	log.Fatal("Error loading .env file")
 	// }
 
-	user = os.Getenv("SMTP_USER") // Removed := operator
-	if user == "" {
-		log.Fatal("Error loading smtp user variables")
+	configured, err := NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Error loading mail settings: %v", err)
+	}
+	switch configured.(type) {
+	case LogMailer:
+		log.Println("MAIL_BACKEND=log prints every email, sign in codes included, do not use it in production")
+	case unconfiguredMailer:
+		log.Println("SMTP_USER and MAIL_BACKEND are not set, sending emails will fail")
 	}
+	SetMailer(configured)
 
-	smtpPassword := os.Getenv("SMTP_PASSWORD")
-	if smtpPassword == "" {
-		log.Fatal("Error loading smtp password variables")
+	sender = os.Getenv("MAIL_FROM")
+	if sender == "" {
+		address := os.Getenv("SMTP_USER")
+		if address == "" {
+			address = "no-reply@localhost"
+		}
+		sender = "GoStoreApp <" + address + ">"
 	}
-	Auth = smtp.PlainAuth("", user, smtpPassword, "smtp.gmail.com")
 }
 
+// OTP purposes pick the subject of the one-time code email
+const (
+	OTPLogin         = "login"
+	OTPResetPassword = "reset-password"
+)
+
 type EmailData struct {
-	OTP string
+	OTP     string
+	Purpose string
 }
 
-const htmlTemplateString = `
-<!DOCTYPE html>
-<html>
-  <body>
-    <h1>Hello</h1>
-    <p>Your OTP is: {{.OTP}}</p>
-  </body>
-</html>
-`
+// SendOTPEmail mails a one-time code; purpose is OTPLogin, OTPResetPassword or anything else for a generic subject.
+func SendOTPEmail(userEmail string, locale string, otp string, purpose string) error {
+	data := EmailData{
+		OTP:     otp,
+		Purpose: purpose,
+	}
+	return send(userEmail, locale, "otp", data)
+}
 
-func SendOTPEmail(userEmail string, otp string, title string) error {
-	tmpl, err := template.New("otpEmail").Parse(htmlTemplateString)
-	if err != nil {
-		return err
+type InviteData struct {
+	Role string
+	Link string
+}
+
+// SendInviteEmail mails an admin invitation link to the invitee.
+func SendInviteEmail(userEmail string, locale string, link string, role string) error {
+	data := InviteData{
+		Role: role,
+		Link: link,
 	}
+	return send(userEmail, locale, "invite", data)
+}
 
-	data := EmailData{
-		OTP: otp,
+type LockedData struct {
+	Until string
+}
+
+// SendAccountLockedEmail warns a user that repeated failed logins locked their account.
+func SendAccountLockedEmail(userEmail string, locale string, until time.Time) error {
+	data := LockedData{
+		Until: until.UTC().Format("02 Jan 2006 15:04 MST"),
 	}
+	return send(userEmail, locale, "account-locked", data)
+}
 
-	var tpl bytes.Buffer
-	if err = tmpl.Execute(&tpl, data); err != nil {
-		return err
+type MagicLinkData struct {
+	Link    string
+	Minutes int
+}
+
+// SendMagicLinkEmail mails a single use sign in link.
+func SendMagicLinkEmail(userEmail string, locale string, link string, expiresIn time.Duration) error {
+	data := MagicLinkData{
+		Link:    link,
+		Minutes: int(expiresIn.Minutes()),
 	}
+	return send(userEmail, locale, "magic-link", data)
+}
 
-	headers := "MIME-Version: 1.0\r\n" +
-		"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
-		"From: GoStoreApp <phemmynesce4life@gmail.com>\r\n" +
-		"To: " + userEmail + "\r\n" +
-		"Subject: " + title + " \r\n"
+type NewDeviceData struct {
+	Device string
+	IP     string
+	At     string
+}
 
-	msg := []byte(headers + "\r\n" + tpl.String())
+// SendNewDeviceEmail alerts a user that their account was signed in to from an unfamiliar device.
+func SendNewDeviceEmail(userEmail string, locale string, device string, ip string, at time.Time) error {
+	data := NewDeviceData{
+		Device: device,
+		IP:     ip,
+		At:     at.UTC().Format("02 Jan 2006 15:04 MST"),
+	}
+	return send(userEmail, locale, "new-device", data)
+}
 
-	fmt.Println("start sending email")
-	err = smtp.SendMail("smtp.gmail.com:587", Auth, user, []string{userEmail}, msg)
-	if err != nil {
-        return err
-    }
-	fmt.Println("stop sending email")
+type EmailChangeData struct {
+	Email string
+	Link  string
+}
+
+// SendConfirmEmailChangeEmail mails the link that confirms a new address.
+func SendConfirmEmailChangeEmail(newEmail string, locale string, link string) error {
+	data := EmailChangeData{
+		Email: newEmail,
+		Link:  link,
+	}
+	return send(newEmail, locale, "confirm-email-change", data)
+}
+
+// SendEmailChangeNoticeEmail warns the current address that a change was requested.
+func SendEmailChangeNoticeEmail(oldEmail string, locale string, newEmail string) error {
+	data := EmailChangeData{
+		Email: newEmail,
+	}
+	return send(oldEmail, locale, "email-change-notice", data)
+}
+
+// SendPasswordResetRequiredEmail tells a user an administrator forced them to reset their password.
+func SendPasswordResetRequiredEmail(userEmail string, locale string) error {
+	return send(userEmail, locale, "password-reset-required", nil)
+}
+
+type ErasureData struct {
+	Date string
+}
+
+// SendErasureScheduledEmail confirms an account deletion request and when it takes effect.
+func SendErasureScheduledEmail(userEmail string, locale string, at time.Time) error {
+	data := ErasureData{
+		Date: at.UTC().Format("02 Jan 2006"),
+	}
+	return send(userEmail, locale, "erasure-scheduled", data)
+}
+
+type NotificationData struct {
+	Event           string
+	HomeTeam        string
+	AwayTeam        string
+	HomeGoals       int
+	AwayGoals       int
+	Kickoff         string
+	PreviousKickoff string
+	UnsubscribeLink string
+}
+
+// SendNotificationEmail tells a fan about one event for a team or competition they follow;
+// listUnsubscribe is the endpoint mail clients POST to for one-click unsubscribe.
+func SendNotificationEmail(userEmail string, locale string, data NotificationData, listUnsubscribe string) error {
+	return sendWithHeaders(userEmail, locale, "notification", data, unsubscribeHeaders(listUnsubscribe))
+}
+
+type DigestData struct {
+	Items           []NotificationData
+	UnsubscribeLink string
+}
+
+// SendDigestEmail mails the day's notifications in one message.
+func SendDigestEmail(userEmail string, locale string, data DigestData, listUnsubscribe string) error {
+	return sendWithHeaders(userEmail, locale, "digest", data, unsubscribeHeaders(listUnsubscribe))
+}
+
+// unsubscribeHeaders let mail clients offer one-click unsubscribe as described in RFC 8058
+func unsubscribeHeaders(url string) map[string]string {
+	if url == "" {
+		return nil
+	}
+	return map[string]string{
+		"List-Unsubscribe":      "<" + url + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// SampleData returns example data for a template so it can be previewed
+func SampleData(name string) interface{} {
+	now := time.Now()
+	switch name {
+	case "otp":
+		return EmailData{OTP: "123456", Purpose: OTPLogin}
+	case "invite":
+		return InviteData{Role: "admin", Link: "https://example.com/signup?token=preview"}
+	case "account-locked":
+		return LockedData{Until: now.Add(15 * time.Minute).UTC().Format("02 Jan 2006 15:04 MST")}
+	case "magic-link":
+		return MagicLinkData{Link: "https://example.com/magic-link?token=preview", Minutes: 15}
+	case "new-device":
+		return NewDeviceData{Device: "Chrome on Windows", IP: "203.0.113.7", At: now.UTC().Format("02 Jan 2006 15:04 MST")}
+	case "confirm-email-change":
+		return EmailChangeData{Email: "fan@example.com", Link: "https://example.com/confirm-email?token=preview"}
+	case "email-change-notice":
+		return EmailChangeData{Email: "fan@example.com"}
+	case "notification":
+		return sampleNotification(now)
+	case "digest":
+		rescheduled := sampleNotification(now)
+		rescheduled.Event = "fixture_rescheduled"
+		rescheduled.PreviousKickoff = now.Add(-24 * time.Hour).UTC().Format("02 Jan 2006 15:04 MST")
+		return DigestData{
+			Items:           []NotificationData{sampleNotification(now), rescheduled},
+			UnsubscribeLink: "https://example.com/unsubscribe?token=preview",
+		}
+	case "erasure-scheduled":
+		return ErasureData{Date: now.AddDate(0, 0, 14).UTC().Format("02 Jan 2006")}
+	}
 	return nil
 }
+
+func sampleNotification(now time.Time) NotificationData {
+	return NotificationData{
+		Event:           "kickoff_reminder",
+		HomeTeam:        "Riverside FC",
+		AwayTeam:        "Harbour United",
+		Kickoff:         now.Add(2 * time.Hour).UTC().Format("02 Jan 2006 15:04 MST"),
+		UnsubscribeLink: "https://example.com/unsubscribe?token=preview",
+	}
+}
+
+// send renders a template in the recipient's locale and queues it, or sends it when there is no outbox
+func send(userEmail string, locale string, name string, data interface{}) error {
+	return sendWithHeaders(userEmail, locale, name, data, nil)
+}
+
+func sendWithHeaders(userEmail string, locale string, name string, data interface{}, headers map[string]string) error {
+	rendered, err := Render(name, locale, data)
+	if err != nil {
+		return err
+	}
+
+	m := getOutbox()
+	if m == nil {
+		m = getMailer()
+	}
+	return m.Send(Message{
+		From:    sender,
+		To:      []string{userEmail},
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+		Headers: headers,
+		SentAt:  time.Now(),
+	})
+}
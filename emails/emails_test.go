@@ -0,0 +1,250 @@
+package emails
+
+import (
+	"bufio"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	memory := &MemoryMailer{}
+	SetMailer(memory)
+	defer SetMailer(LogMailer{})
+
+	err := SendOTPEmail("fan@example.com", "", "1234", OTPResetPassword)
+	assert.NoError(t, err)
+
+	msg, ok := memory.Last()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"fan@example.com"}, msg.To)
+	assert.Equal(t, "Reset your password", msg.Subject)
+	assert.Contains(t, msg.HTML, "1234")
+	assert.Contains(t, msg.Text, "1234")
+
+	memory.Reset()
+	assert.Empty(t, memory.Messages())
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	file := &FileMailer{Dir: dir}
+
+	err := file.Send(Message{From: "League <no-reply@localhost>", To: []string{"fan@example.com"}, Subject: "Hi", HTML: "<p>hello</p>", SentAt: time.Now()})
+	assert.NoError(t, err)
+
+	eml, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, eml, 1)
+
+	content, err := os.ReadFile(eml[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Subject: Hi")
+	assert.Contains(t, string(content), "<p>hello</p>")
+}
+
+func TestRender(t *testing.T) {
+	for _, name := range Templates() {
+		for _, locale := range Locales() {
+			rendered, err := Render(name, locale, SampleData(name))
+			assert.NoError(t, err, name+" "+locale)
+			assert.NotEmpty(t, rendered.Subject, name+" "+locale)
+			assert.Contains(t, rendered.HTML, `<html lang="`+locale+`">`)
+			assert.NotContains(t, rendered.Text, "<p>")
+		}
+	}
+
+	rendered, err := Render("otp", "fr", EmailData{OTP: "9876", Purpose: OTPLogin})
+	assert.NoError(t, err)
+	assert.Equal(t, "Confirmez votre connexion", rendered.Subject)
+	assert.Contains(t, rendered.Text, "9876")
+	assert.Contains(t, rendered.HTML, "Merci de ne pas répondre")
+
+	rendered, err = Render("digest", "en", SampleData("digest"))
+	assert.NoError(t, err)
+	assert.Contains(t, rendered.Text, "Riverside FC v Harbour United kicks off at")
+	assert.Contains(t, rendered.HTML, "https://example.com/unsubscribe?token=preview")
+
+	_, err = Render("does-not-exist", "en", nil)
+	assert.ErrorIs(t, err, ErrUnknownTemplate)
+}
+
+func TestResolveLocale(t *testing.T) {
+	assert.Equal(t, "fr", ResolveLocale("otp", "fr-CA"))
+	assert.Equal(t, "fr", ResolveLocale("otp", "fr_FR"))
+	assert.Equal(t, DefaultLocale, ResolveLocale("otp", "de"))
+	assert.Equal(t, DefaultLocale, ResolveLocale("otp", ""))
+}
+
+func TestMultipartMessage(t *testing.T) {
+	msg := Message{From: "League <no-reply@localhost>", To: []string{"fan@example.com"}, Subject: "Hi", HTML: "<p>hello</p>", Text: "hello", SentAt: time.Now()}
+	content := string(msg.Bytes())
+	assert.Contains(t, content, "Content-Type: multipart/alternative")
+	assert.Contains(t, content, "text/plain")
+	assert.Contains(t, content, "<p>hello</p>")
+	assert.Less(t, strings.Index(content, "text/plain"), strings.Index(content, "text/html"))
+}
+
+func TestMessageEncoding(t *testing.T) {
+	text := "Le match commence bientôt. " + strings.Repeat("a", 200)
+	msg := Message{From: "League <no-reply@localhost>", To: []string{"fan@example.com"}, Subject: "Hi", HTML: "<p style=\"color: red\">" + text + "</p>", Text: text, SentAt: time.Now()}
+	content := string(msg.Bytes())
+
+	// every part is 7-bit with short lines
+	assert.Equal(t, 2, strings.Count(content, "Content-Transfer-Encoding: quoted-printable"))
+	body := content[strings.Index(content, "\r\n\r\n"):]
+	for _, line := range strings.Split(body, "\r\n") {
+		assert.LessOrEqual(t, len(line), 76)
+		for _, r := range line {
+			assert.Less(t, r, rune(128), line)
+		}
+	}
+	assert.Contains(t, content, "bient=C3=B4t")
+
+	// the encoding is undone by readers
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader("bient=C3=B4t")))
+	assert.NoError(t, err)
+	assert.Equal(t, "bientôt", string(decoded))
+}
+
+func TestUnsubscribeHeaders(t *testing.T) {
+	msg := Message{From: "League <no-reply@localhost>", To: []string{"fan@example.com"}, Subject: "Hi", HTML: "<p>hello</p>", SentAt: time.Now()}
+	msg.Headers = unsubscribeHeaders("https://example.com/api/v1/notifications/unsubscribe?token=abc")
+	content := string(msg.Bytes())
+	assert.Contains(t, content, "List-Unsubscribe: <https://example.com/api/v1/notifications/unsubscribe?token=abc>\r\n")
+	assert.Contains(t, content, "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+	assert.Nil(t, unsubscribeHeaders(""))
+
+	// a value cannot start a header of its own
+	msg.Headers = map[string]string{"X-Test": "value\r\nBcc: someone@example.com"}
+	assert.NotContains(t, string(msg.Bytes()), "\r\nBcc:")
+}
+
+func TestNewMailerFromEnv(t *testing.T) {
+	t.Setenv("MAIL_BACKEND", "memory")
+	m, err := NewMailerFromEnv()
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryMailer{}, m)
+
+	// emails are only logged when asked for, without a mail setup sending fails instead of starting up
+	t.Setenv("MAIL_BACKEND", "")
+	t.Setenv("SMTP_USER", "")
+	m, err = NewMailerFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, ErrMailNotConfigured, m.Send(Message{To: []string{"fan@example.com"}}))
+
+	t.Setenv("SMTP_USER", "league@example.com")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	m, err = NewMailerFromEnv()
+	assert.NoError(t, err)
+	assert.IsType(t, &SMTPMailer{}, m)
+
+	t.Setenv("MAIL_BACKEND", "log")
+	m, err = NewMailerFromEnv()
+	assert.NoError(t, err)
+	assert.IsType(t, LogMailer{}, m)
+
+	t.Setenv("MAIL_BACKEND", "smtp")
+	t.Setenv("SMTP_TLS", "sometimes")
+	_, err = NewMailerFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("MAIL_BACKEND", "pigeon")
+	_, err = NewMailerFromEnv()
+	assert.Error(t, err)
+}
+
+// fakeSMTPServer accepts one message and returns its data on the channel
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	received := make(chan string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		write := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		write("220 localhost ESMTP")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					write("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				write("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				inData = true
+				write("354 go ahead")
+			case strings.HasPrefix(cmd, "QUIT"):
+				write("221 bye")
+				return
+			default:
+				write("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	host, port, err := net.SplitHostPort(addr)
+	assert.NoError(t, err)
+
+	smtpMailer := &SMTPMailer{Host: host, Port: port, TLS: "none", Timeout: time.Second}
+	err = smtpMailer.Send(Message{From: "League <no-reply@localhost>", To: []string{"fan@example.com"}, Subject: "Kickoff", HTML: "<p>soon</p>", SentAt: time.Now()})
+	assert.NoError(t, err)
+
+	select {
+	case data := <-received:
+		assert.Contains(t, data, "Subject: Kickoff")
+		assert.Contains(t, data, "<p>soon</p>")
+	case <-time.After(time.Second):
+		t.Fatal("smtp server did not receive the message")
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	memory := &MemoryMailer{}
+	queued := &MemoryMailer{}
+	SetMailer(memory)
+	SetOutbox(queued)
+	defer SetMailer(LogMailer{})
+	defer SetOutbox(nil)
+
+	err := SendPasswordResetRequiredEmail("fan@example.com", "")
+	assert.NoError(t, err)
+	assert.Empty(t, memory.Messages())
+	assert.Len(t, queued.Messages(), 1)
+
+	msg, _ := queued.Last()
+	assert.NoError(t, Deliver(msg))
+	assert.Len(t, memory.Messages(), 1)
+}
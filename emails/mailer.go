@@ -0,0 +1,334 @@
+package emails
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a single email ready to be handed to a Mailer
+type Message struct {
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	HTML    string   `json:"html"`
+	Text    string   `json:"text,omitempty"`
+	// Headers are extra header fields, such as List-Unsubscribe
+	Headers map[string]string `json:"headers,omitempty"`
+	SentAt  time.Time         `json:"sent_at"`
+}
+
+// Bytes renders the message as MIME, multipart/alternative when it has a plain text part
+func (m Message) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("From: " + m.From + "\r\n")
+	buf.WriteString("To: " + strings.Join(m.To, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", m.Subject) + "\r\n")
+	buf.WriteString("Date: " + m.SentAt.Format(time.RFC1123Z) + "\r\n")
+	keys := make([]string, 0, len(m.Headers))
+	for key := range m.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// a line break in a value would let it inject headers of its own
+		value := strings.NewReplacer("\r", "", "\n", "").Replace(m.Headers[key])
+		buf.WriteString(textproto.CanonicalMIMEHeaderKey(key) + ": " + value + "\r\n")
+	}
+	// bodies are quoted-printable so accented text and long lines survive strict 7-bit servers
+	if m.Text == "" {
+		buf.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		buf.WriteString("\r\n")
+		writeQuotedPrintable(&buf, m.HTML)
+		return buf.Bytes()
+	}
+
+	// plain text goes first so clients that understand HTML prefer the last part
+	parts := multipart.NewWriter(&buf)
+	buf.WriteString("Content-Type: multipart/alternative; boundary=\"" + parts.Boundary() + "\"\r\n")
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=\"UTF-8\"", m.Text},
+		{"text/html; charset=\"UTF-8\"", m.HTML},
+	} {
+		w, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		writeQuotedPrintable(w, part.body)
+	}
+	parts.Close()
+	return buf.Bytes()
+}
+
+func writeQuotedPrintable(w io.Writer, body string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(body))
+	qp.Close()
+}
+
+// Mailer delivers messages; pick one with MAIL_BACKEND or replace it with SetMailer
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer delivers through an SMTP server. TLS is "starttls", "tls" for implicit TLS, or "none".
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	TLS      string
+	Timeout  time.Duration
+}
+
+func (s *SMTPMailer) Send(msg Message) error {
+	addr := net.JoinHostPort(s.Host, s.Port)
+	dialer := &net.Dialer{Timeout: s.Timeout}
+	tlsConfig := &tls.Config{ServerName: s.Host}
+
+	var conn net.Conn
+	var err error
+	if s.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %v", err)
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start smtp session: %v", err)
+	}
+	defer client.Close()
+
+	if s.TLS == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start tls: %v", err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate with smtp server: %v", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %v: %v", msg.From, err)
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// MemoryMailer keeps messages in memory so tests can assert on them
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the most recent message, if any
+func (m *MemoryMailer) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		return Message{}, false
+	}
+	return m.messages[len(m.messages)-1], true
+}
+
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+// FileMailer writes every message to Dir as an .eml file with a .json copy next to it
+type FileMailer struct {
+	Dir string
+}
+
+func (f *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s", msg.SentAt.UnixNano(), sanitize(strings.Join(msg.To, "_")))
+	if err := os.WriteFile(filepath.Join(f.Dir, name+".eml"), msg.Bytes(), 0o644); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(f.Dir, name+".json"), data, 0o644)
+}
+
+func sanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' || r == '@' {
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// LogMailer prints messages, bodies included, instead of sending them; it is only for local development
+// because sign in codes and links end up in the logs
+type LogMailer struct{}
+
+func (LogMailer) Send(msg Message) error {
+	body := msg.Text
+	if body == "" {
+		body = msg.HTML
+	}
+	log.Printf("email to %v: %v\n%v", strings.Join(msg.To, ", "), msg.Subject, body)
+	return nil
+}
+
+var mailer Mailer = LogMailer{}
+var outbox Mailer
+var sender string
+var mailerMu sync.RWMutex
+
+// SetMailer replaces the active mailer, e.g. with a MemoryMailer in tests
+func SetMailer(m Mailer) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	mailer = m
+}
+
+func getMailer() Mailer {
+	mailerMu.RLock()
+	defer mailerMu.RUnlock()
+	return mailer
+}
+
+// SetOutbox queues every email with m instead of sending it straight away; the outbox then
+// hands each message to Deliver. Pass nil to send directly again.
+func SetOutbox(m Mailer) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	outbox = m
+}
+
+func getOutbox() Mailer {
+	mailerMu.RLock()
+	defer mailerMu.RUnlock()
+	return outbox
+}
+
+// Deliver sends a message with the configured mailer, bypassing the outbox
+func Deliver(msg Message) error {
+	return getMailer().Send(msg)
+}
+
+var ErrMailNotConfigured = errors.New("mail is not configured, set SMTP_USER or MAIL_BACKEND")
+
+// unconfiguredMailer fails every send, so a missing mail setup shows up when an email is sent
+// rather than stopping the process, e.g. in tests that install their own mailer with SetMailer
+type unconfiguredMailer struct{}
+
+func (unconfiguredMailer) Send(msg Message) error {
+	return ErrMailNotConfigured
+}
+
+// NewMailerFromEnv builds the mailer named by MAIL_BACKEND: smtp, file, memory or log.
+// Without MAIL_BACKEND smtp is used when SMTP_USER is set, and otherwise every send fails with
+// ErrMailNotConfigured; an unauthenticated relay needs MAIL_BACKEND=smtp.
+func NewMailerFromEnv() (Mailer, error) {
+	backend := strings.ToLower(os.Getenv("MAIL_BACKEND"))
+	if backend == "" {
+		if os.Getenv("SMTP_USER") == "" {
+			return unconfiguredMailer{}, nil
+		}
+		backend = "smtp"
+	}
+
+	switch backend {
+	case "smtp":
+		smtpMailer := &SMTPMailer{
+			Host:     envOr("SMTP_HOST", "smtp.gmail.com"),
+			Port:     envOr("SMTP_PORT", "587"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			TLS:      strings.ToLower(envOr("SMTP_TLS", "starttls")),
+			Timeout:  10 * time.Second,
+		}
+		if smtpMailer.TLS != "starttls" && smtpMailer.TLS != "tls" && smtpMailer.TLS != "none" {
+			return nil, fmt.Errorf("SMTP_TLS must be starttls, tls or none, got %v", smtpMailer.TLS)
+		}
+		if smtpMailer.Username != "" && smtpMailer.Password == "" {
+			return nil, errors.New("SMTP_PASSWORD is required when SMTP_USER is set")
+		}
+		return smtpMailer, nil
+	case "file":
+		return &FileMailer{Dir: envOr("MAIL_DIR", "mail")}, nil
+	case "memory":
+		return &MemoryMailer{}, nil
+	case "log":
+		return LogMailer{}, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_BACKEND %v", backend)
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
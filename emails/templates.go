@@ -0,0 +1,159 @@
+package emails
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Templates live in templates/<locale>/<name>.html and <name>.txt. The .txt file also defines
+// the "subject"; both share the layouts in templates/layouts and the locale's partials.
+//
+//go:embed templates
+var templateFS embed.FS
+
+// DefaultLocale is used when a user has no locale or a template has no translation
+const DefaultLocale = "en"
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// Rendered is a template executed for one locale
+type Rendered struct {
+	Locale  string `json:"locale"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+type templateSet struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+var templateCache = map[string]*templateSet{}
+var templateMu sync.Mutex
+
+// Locales lists the locales that have templates
+func Locales() []string {
+	entries, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return []string{DefaultLocale}
+	}
+	var locales []string
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != "layouts" {
+			locales = append(locales, entry.Name())
+		}
+	}
+	return locales
+}
+
+// Templates lists every template name available in the default locale
+func Templates() []string {
+	files, _ := fs.Glob(templateFS, "templates/"+DefaultLocale+"/*.html")
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(path.Base(file), ".html"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveLocale picks the best available locale: "fr-CA" tries fr-ca, then fr, then DefaultLocale
+func ResolveLocale(name string, locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	for locale != "" {
+		if hasTemplate(locale, name) {
+			return locale
+		}
+		cut := strings.LastIndex(locale, "-")
+		if cut < 0 {
+			break
+		}
+		locale = locale[:cut]
+	}
+	return DefaultLocale
+}
+
+func hasTemplate(locale string, name string) bool {
+	_, err := fs.Stat(templateFS, "templates/"+locale+"/"+name+".html")
+	return err == nil
+}
+
+// Render executes the named template in the user's locale, falling back to DefaultLocale
+func Render(name string, locale string, data interface{}) (*Rendered, error) {
+	locale = ResolveLocale(name, locale)
+	if !hasTemplate(locale, name) {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownTemplate, name)
+	}
+	set, err := loadTemplate(locale, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := set.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject of %v: %v", name, err)
+	}
+	if err := set.text.ExecuteTemplate(&text, "base.txt", data); err != nil {
+		return nil, fmt.Errorf("failed to render text of %v: %v", name, err)
+	}
+	if err := set.html.ExecuteTemplate(&html, "base.html", data); err != nil {
+		return nil, fmt.Errorf("failed to render html of %v: %v", name, err)
+	}
+	return &Rendered{
+		Locale:  locale,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+// loadTemplate parses a template once; partials of the default locale are parsed first so a
+// locale only needs to translate the partials that differ
+func loadTemplate(locale string, name string) (*templateSet, error) {
+	templateMu.Lock()
+	defer templateMu.Unlock()
+
+	key := locale + "/" + name
+	if set, ok := templateCache[key]; ok {
+		return set, nil
+	}
+
+	funcs := map[string]interface{}{"locale": func() string { return locale }}
+	html := htmltemplate.New("base.html").Funcs(funcs)
+	text := texttemplate.New("base.txt").Funcs(funcs)
+	for _, pattern := range templatePatterns(locale, name, "html") {
+		if _, err := html.ParseFS(templateFS, pattern); err != nil {
+			return nil, fmt.Errorf("failed to parse %v: %v", pattern, err)
+		}
+	}
+	for _, pattern := range templatePatterns(locale, name, "txt") {
+		if _, err := text.ParseFS(templateFS, pattern); err != nil {
+			return nil, fmt.Errorf("failed to parse %v: %v", pattern, err)
+		}
+	}
+
+	set := &templateSet{html: html, text: text}
+	templateCache[key] = set
+	return set, nil
+}
+
+func templatePatterns(locale string, name string, ext string) []string {
+	patterns := []string{"templates/layouts/base." + ext}
+	for _, dir := range []string{DefaultLocale, locale} {
+		partials := "templates/" + dir + "/partials/*." + ext
+		if matches, _ := fs.Glob(templateFS, partials); len(matches) > 0 && (dir == DefaultLocale || locale != DefaultLocale) {
+			patterns = append(patterns, partials)
+		}
+	}
+	return append(patterns, "templates/"+locale+"/"+name+"."+ext)
+}
@@ -0,0 +1,163 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Event is something that happened inside the service; Name identifies the kind of event
+type Event interface {
+	Name() string
+}
+
+type handler struct {
+	fn    func(Event) error
+	async bool
+}
+
+// Bus delivers published events to the handlers subscribed to them
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]handler
+	// inTransaction handlers only run for PublishInTransaction
+	inTransaction map[string][]func(context.Context, Event) error
+	wg            sync.WaitGroup
+}
+
+func New() *Bus {
+	return &Bus{handlers: map[string][]handler{}, inTransaction: map[string][]func(context.Context, Event) error{}}
+}
+
+// defaultBus is the bus services publish to and subscribe on
+var defaultBus = New()
+
+func (b *Bus) subscribe(name string, h handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], h)
+}
+
+// Publish runs the synchronous handlers in the order they subscribed and returns their errors joined,
+// asynchronous handlers run in their own goroutine and only log failures
+func (b *Bus) Publish(event Event) error {
+	b.mu.RLock()
+	handlers := b.handlers[event.Name()]
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, h := range handlers {
+		if h.async {
+			b.wg.Add(1)
+			go b.runAsync(event, h.fn)
+			continue
+		}
+		if err := h.fn(event); err != nil {
+			errs = append(errs, fmt.Errorf("%v handler: %v", event.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Bus) runAsync(event Event, fn func(Event) error) {
+	defer b.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("%v handler panicked: %v \n", event.Name(), r)
+		}
+	}()
+	if err := fn(event); err != nil {
+		fmt.Printf("%v handler: %v \n", event.Name(), err)
+	}
+}
+
+// PublishCommitted publishes an event for a change that is already saved; the change stands either way,
+// so handler errors are logged instead of being returned to the caller as a failed write
+func (b *Bus) PublishCommitted(event Event) {
+	if err := b.Publish(event); err != nil {
+		fmt.Printf("could not publish %v: %v \n", event.Name(), err)
+	}
+}
+
+// PublishInTransaction runs the handlers subscribed in transaction, in the order they subscribed, with the transaction's ctx.
+// It is called inside db.Transaction before the change commits, the first error stops the rest and aborts the change;
+// errors wrap the handler's so transient ones are retried
+func (b *Bus) PublishInTransaction(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := b.inTransaction[event.Name()]
+	b.mu.RUnlock()
+
+	for _, fn := range handlers {
+		if err := fn(ctx, event); err != nil {
+			return fmt.Errorf("%v handler: %w", event.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Wait blocks until every asynchronous handler started so far has returned
+func (b *Bus) Wait() {
+	b.wg.Wait()
+}
+
+// wrap turns a typed handler into one the bus can store; events are published as values, not pointers
+func wrap[E Event](fn func(E) error) (string, func(Event) error) {
+	var zero E
+	return zero.Name(), func(event Event) error {
+		return fn(event.(E))
+	}
+}
+
+// SubscribeTo registers a handler that runs before Publish returns, its error is returned to the publisher
+func SubscribeTo[E Event](b *Bus, fn func(E) error) {
+	name, h := wrap(fn)
+	b.subscribe(name, handler{fn: h})
+}
+
+// SubscribeInTransactionTo registers a handler for writes that must commit or roll back with the change,
+// it only runs when the event is published in transaction and has to use the ctx it is given
+func SubscribeInTransactionTo[E Event](b *Bus, fn func(context.Context, E) error) {
+	var zero E
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inTransaction[zero.Name()] = append(b.inTransaction[zero.Name()], func(ctx context.Context, event Event) error {
+		return fn(ctx, event.(E))
+	})
+}
+
+// SubscribeAsyncTo registers a handler that runs in the background, the publisher never waits for it
+func SubscribeAsyncTo[E Event](b *Bus, fn func(E) error) {
+	name, h := wrap(fn)
+	b.subscribe(name, handler{fn: h, async: true})
+}
+
+// Subscribe registers a synchronous handler on the service bus
+func Subscribe[E Event](fn func(E) error) {
+	SubscribeTo(defaultBus, fn)
+}
+
+// SubscribeAsync registers an asynchronous handler on the service bus
+func SubscribeAsync[E Event](fn func(E) error) {
+	SubscribeAsyncTo(defaultBus, fn)
+}
+
+// SubscribeInTransaction registers a handler on the service bus that runs inside the transaction making the change
+func SubscribeInTransaction[E Event](fn func(context.Context, E) error) {
+	SubscribeInTransactionTo(defaultBus, fn)
+}
+
+// PublishInTransaction runs the service bus handlers subscribed in transaction
+func PublishInTransaction(ctx context.Context, event Event) error {
+	return defaultBus.PublishInTransaction(ctx, event)
+}
+
+// Publish sends an event to every handler on the service bus
+func Publish(event Event) error {
+	return defaultBus.Publish(event)
+}
+
+// PublishCommitted sends an event for a saved change to the service bus and logs handler failures
+func PublishCommitted(event Event) {
+	defaultBus.PublishCommitted(event)
+}
@@ -0,0 +1,244 @@
+package events
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+
+	"time"
+)
+
+// Actor fields say who made a change for the audit log, they are zero for changes users make to their own account
+
+// fixtures
+
+type FixtureCreated struct {
+	Actor   models.AuditActor
+	Fixture models.Fixture
+}
+
+// FixtureUpdated is published for every edit, the narrower fixture events below follow it when they apply
+type FixtureUpdated struct {
+	Actor  models.AuditActor
+	Before models.Fixture
+	After  models.Fixture
+}
+
+type FixtureStatsUpdated struct {
+	Actor  models.AuditActor
+	Before models.Fixture
+	After  models.Fixture
+}
+
+// FixtureRestored is published when a fixture is put back to an earlier revision
+type FixtureRestored struct {
+	Actor    models.AuditActor
+	Before   models.Fixture
+	After    models.Fixture
+	Revision int
+}
+
+type FixtureRescheduled struct {
+	Fixture      models.Fixture
+	PreviousDate time.Time
+}
+
+type FixtureStatusChanged struct {
+	Fixture        models.Fixture
+	PreviousStatus models.Status
+}
+
+type FixtureScoreChanged struct {
+	Fixture      models.Fixture
+	PreviousHome int
+	PreviousAway int
+}
+
+type LineupPublished struct {
+	Fixture models.Fixture
+}
+
+type FixtureDeleted struct {
+	Actor   models.AuditActor
+	Fixture models.Fixture
+}
+
+// FixtureUndeleted is published when a fixture is taken back out of the trash
+type FixtureUndeleted struct {
+	Actor   models.AuditActor
+	Fixture models.Fixture
+}
+
+func (FixtureCreated) Name() string       { return "fixture.created" }
+func (FixtureUpdated) Name() string       { return "fixture.updated" }
+func (FixtureStatsUpdated) Name() string  { return "fixture.stats_updated" }
+func (FixtureRestored) Name() string      { return "fixture.restored" }
+func (FixtureRescheduled) Name() string   { return "fixture.rescheduled" }
+func (FixtureStatusChanged) Name() string { return "fixture.status_changed" }
+func (FixtureScoreChanged) Name() string  { return "fixture.score_changed" }
+func (LineupPublished) Name() string      { return "fixture.lineup_published" }
+func (FixtureDeleted) Name() string       { return "fixture.deleted" }
+func (FixtureUndeleted) Name() string     { return "fixture.undeleted" }
+
+// teams
+
+type TeamCreated struct {
+	Actor models.AuditActor
+	Team  models.Team
+}
+
+type TeamUpdated struct {
+	Actor  models.AuditActor
+	Before models.Team
+	Team   models.Team
+}
+
+type TeamDeleted struct {
+	Actor models.AuditActor
+	Team  models.Team
+}
+
+type TeamUndeleted struct {
+	Actor models.AuditActor
+	Team  models.Team
+}
+
+type PlayerUpdated struct {
+	Actor  models.AuditActor
+	Before models.Player
+	After  models.Player
+}
+
+func (TeamCreated) Name() string   { return "team.created" }
+func (TeamUpdated) Name() string   { return "team.updated" }
+func (TeamDeleted) Name() string   { return "team.deleted" }
+func (TeamUndeleted) Name() string { return "team.undeleted" }
+func (PlayerUpdated) Name() string { return "player.updated" }
+
+// users
+
+// UserUpdated carries the stored user after a change to their own profile or email
+type UserUpdated struct {
+	User models.User
+}
+
+type UserRoleChanged struct {
+	Actor  models.AuditActor
+	Before models.User
+	After  models.User
+}
+
+type UserClubsChanged struct {
+	Actor  models.AuditActor
+	Before models.User
+	After  models.User
+}
+
+type UserSuspended struct {
+	Actor     models.AuditActor
+	Before    models.User
+	After     models.User
+	Suspended bool
+}
+
+type PasswordResetForced struct {
+	Actor models.AuditActor
+	User  models.User
+}
+
+type ErasureScheduled struct {
+	User models.User
+	At   time.Time
+}
+
+type ErasureCancelled struct {
+	UserID primitive.ObjectID
+}
+
+type UserErased struct {
+	UserID primitive.ObjectID
+}
+
+type UserDeleted struct {
+	Actor  models.AuditActor
+	UserID primitive.ObjectID
+}
+
+type UserUndeleted struct {
+	Actor models.AuditActor
+	User  models.User
+}
+
+type ImpersonationStarted struct {
+	Actor  models.AuditActor
+	Target models.User
+}
+
+func (UserUpdated) Name() string          { return "user.updated" }
+func (UserRoleChanged) Name() string      { return "user.role_changed" }
+func (UserClubsChanged) Name() string     { return "user.clubs_changed" }
+func (UserSuspended) Name() string        { return "user.suspended" }
+func (PasswordResetForced) Name() string  { return "user.password_reset_forced" }
+func (ErasureScheduled) Name() string     { return "user.erasure_scheduled" }
+func (ErasureCancelled) Name() string     { return "user.erasure_cancelled" }
+func (UserErased) Name() string           { return "user.erased" }
+func (UserDeleted) Name() string          { return "user.deleted" }
+func (UserUndeleted) Name() string        { return "user.undeleted" }
+func (ImpersonationStarted) Name() string { return "user.impersonation_started" }
+
+// auth
+
+// VerificationTokenUsed is published once a one time password has been spent
+type VerificationTokenUsed struct {
+	UserID primitive.ObjectID
+}
+
+func (VerificationTokenUsed) Name() string { return "auth.verification_token_used" }
+
+type InviteCreated struct {
+	Actor  models.AuditActor
+	Invite models.Invite
+}
+
+type InviteRevoked struct {
+	Actor  models.AuditActor
+	Before models.Invite
+	After  models.Invite
+}
+
+func (InviteCreated) Name() string { return "auth.invite_created" }
+func (InviteRevoked) Name() string { return "auth.invite_revoked" }
+
+// roles
+
+type RoleCreated struct {
+	Actor models.AuditActor
+	Role  models.RoleDefinition
+}
+
+type RoleUpdated struct {
+	Actor  models.AuditActor
+	Before models.RoleDefinition
+	After  models.RoleDefinition
+}
+
+type RoleDeleted struct {
+	Actor models.AuditActor
+	Role  models.RoleDefinition
+}
+
+func (RoleCreated) Name() string { return "role.created" }
+func (RoleUpdated) Name() string { return "role.updated" }
+func (RoleDeleted) Name() string { return "role.deleted" }
+
+// integrity
+
+// IntegrityRepaired is published after orphaned references of one relation have been repaired
+type IntegrityRepaired struct {
+	Actor    models.AuditActor
+	Relation string
+	Action   models.OnDelete
+	Repaired int64
+}
+
+func (IntegrityRepaired) Name() string { return "integrity.repaired" }
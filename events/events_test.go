@@ -0,0 +1,124 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+)
+
+func TestPublishSync(t *testing.T) {
+	bus := New()
+	var order []string
+	SubscribeTo(bus, func(e TeamUpdated) error {
+		order = append(order, "first:"+e.Team.Name)
+		return nil
+	})
+	SubscribeTo(bus, func(e TeamUpdated) error {
+		order = append(order, "second:"+e.Team.Name)
+		return nil
+	})
+	SubscribeTo(bus, func(e TeamCreated) error {
+		order = append(order, "created")
+		return nil
+	})
+
+	err := bus.Publish(TeamUpdated{Team: models.Team{Name: "Rovers"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first:Rovers", "second:Rovers"}, order)
+
+	// nothing subscribed is not an error
+	assert.NoError(t, bus.Publish(TeamDeleted{Team: models.Team{ID: primitive.NewObjectID()}}))
+}
+
+func TestPublishJoinsErrors(t *testing.T) {
+	bus := New()
+	first := errors.New("cache unavailable")
+	ran := false
+	SubscribeTo(bus, func(UserDeleted) error { return first })
+	SubscribeTo(bus, func(UserDeleted) error {
+		ran = true
+		return errors.New("audit unavailable")
+	})
+
+	err := bus.Publish(UserDeleted{UserID: primitive.NewObjectID()})
+	assert.Error(t, err)
+	assert.True(t, ran, "a failing handler does not stop the others")
+	assert.Contains(t, err.Error(), "user.deleted handler: cache unavailable")
+	assert.Contains(t, err.Error(), "audit unavailable")
+}
+
+func TestPublishCommitted(t *testing.T) {
+	bus := New()
+	var calls int32
+	SubscribeTo(bus, func(e TeamUpdated) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("cache unavailable")
+	})
+	SubscribeTo(bus, func(e TeamUpdated) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	// a failing handler neither panics nor stops the ones after it
+	bus.PublishCommitted(TeamUpdated{Team: models.Team{Name: "Rovers"}})
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestPublishInTransaction(t *testing.T) {
+	bus := New()
+	type key struct{}
+	var order []string
+	SubscribeInTransactionTo(bus, func(ctx context.Context, e TeamUpdated) error {
+		order = append(order, "audit:"+ctx.Value(key{}).(string))
+		return nil
+	})
+	failure := errors.New("write conflict")
+	SubscribeInTransactionTo(bus, func(ctx context.Context, e TeamUpdated) error {
+		return failure
+	})
+	SubscribeInTransactionTo(bus, func(ctx context.Context, e TeamUpdated) error {
+		order = append(order, "after failure")
+		return nil
+	})
+	SubscribeTo(bus, func(e TeamUpdated) error {
+		order = append(order, "committed")
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), key{}, "tx")
+	err := bus.PublishInTransaction(ctx, TeamUpdated{Team: models.Team{Name: "Rovers"}})
+	assert.ErrorIs(t, err, failure)
+	// the transaction's ctx is passed on, later handlers and ordinary subscribers do not run
+	assert.Equal(t, []string{"audit:tx"}, order)
+
+	assert.NoError(t, bus.Publish(TeamUpdated{Team: models.Team{Name: "Rovers"}}))
+	assert.Equal(t, []string{"audit:tx", "committed"}, order)
+}
+
+func TestPublishAsync(t *testing.T) {
+	bus := New()
+	var calls int32
+	release := make(chan struct{})
+	SubscribeAsyncTo(bus, func(FixtureScoreChanged) error {
+		<-release
+		atomic.AddInt32(&calls, 1)
+		return errors.New("only logged")
+	})
+	SubscribeAsyncTo(bus, func(FixtureScoreChanged) error {
+		panic("recovered")
+	})
+
+	// the publisher neither waits for nor sees asynchronous handlers
+	assert.NoError(t, bus.Publish(FixtureScoreChanged{PreviousHome: 1}))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	close(release)
+	bus.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
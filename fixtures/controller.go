@@ -7,6 +7,7 @@ import (
 	"league/helpers"
 	"league/models"
 
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -69,7 +70,7 @@ func createFixtureHandler(ctx *gin.Context) {
 		UpdatedAt: time.Now(),
 	}
 
-	result, err := createFixture(newFixture)
+	result, err := createFixture(models.AuditActorFromContext(ctx), newFixture)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -119,11 +120,20 @@ func updateFixtureHandler(ctx *gin.Context) {
 		})
 		return
 	}
-	resp, err := updateFixture(ctx.Param("id"), req)
+	version, err := helpers.IfMatch(ctx)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
-			StatusCode: http.StatusBadRequest,
+			StatusCode: helpers.PreconditionStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+	resp, err := updateFixture(models.AuditActorFromContext(ctx), ctx.Param("id"), version, req)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: helpers.PreconditionStatus(err),
 			Data:       nil,
 		})
 		return
@@ -136,6 +146,7 @@ func updateFixtureHandler(ctx *gin.Context) {
 		})
 		return
 	}
+	ctx.Header("ETag", helpers.ETag(resp.Version))
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully updated fixture",
 		StatusCode: http.StatusOK,
@@ -144,6 +155,29 @@ func updateFixtureHandler(ctx *gin.Context) {
 }
 
 func updateFixtureStatsHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := checkFixtureAccess(user, ctx.Param("id")); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrNotClubAdmin) {
+			status = http.StatusForbidden
+		}
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: status,
+			Data:       nil,
+		})
+		return
+	}
+
 	var req UpdateFixtureStats
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
@@ -154,15 +188,25 @@ func updateFixtureStatsHandler(ctx *gin.Context) {
 		return
 	}
 
-	resp, err := updateFixtureStats(ctx.Param("id"), req)
+	version, err := helpers.IfMatch(ctx)
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
-			StatusCode: http.StatusBadRequest,
+			StatusCode: helpers.PreconditionStatus(err),
 			Data:       nil,
 		})
 		return
 	}
+	resp, err := updateFixtureStats(models.AuditActorFromContext(ctx), ctx.Param("id"), version, req)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: helpers.PreconditionStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+	ctx.Header("ETag", helpers.ETag(resp.Version))
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully updated fixture stats",
 		StatusCode: http.StatusOK,
@@ -171,7 +215,7 @@ func updateFixtureStatsHandler(ctx *gin.Context) {
 }
 
 func deleteFixtureHandler(ctx *gin.Context) {
-	err := deleteFixture(ctx.Param("id"))
+	err := deleteFixture(models.AuditActorFromContext(ctx), ctx.Param("id"))
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -224,6 +268,10 @@ func getFixtureByHash(ctx *gin.Context) {
 		})
 		return
 	}
+	// the teams and competition are embedded, their changes have to change the tag too
+	if helpers.NotModifiedTag(ctx, helpers.ContentETag(resp.Version, resp)) {
+		return
+	}
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully fetched fixture",
 		StatusCode: http.StatusOK,
@@ -297,6 +345,10 @@ func singleFixtureHandler(ctx *gin.Context) {
 		})
 		return
 	}
+	// the teams and competition are embedded, their changes have to change the tag too
+	if helpers.NotModifiedTag(ctx, helpers.ContentETag(resp.Version, resp)) {
+		return
+	}
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully fetched fixture",
 		StatusCode: http.StatusOK,
@@ -350,3 +402,132 @@ func getSingleCompetitionsHandler(ctx *gin.Context) {
 		Data:       competition,
 	})
 }
+
+func getHistoryHandler(ctx *gin.Context) {
+	revisions, total, page, perPage, err := getHistory(ctx.Param("id"), ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched fixture history",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     revisions,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func getRevisionHandler(ctx *gin.Context) {
+	revision, err := getRevision(ctx.Param("id"), ctx.Param("revision"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched fixture revision",
+		StatusCode: http.StatusOK,
+		Data:       revision,
+	})
+}
+
+// diffRevisionsHandler compares the revisions given by the from and to query parameters
+func diffRevisionsHandler(ctx *gin.Context) {
+	changes, err := diffRevisions(ctx.Param("id"), ctx.Query("from"), ctx.Query("to"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully compared fixture revisions",
+		StatusCode: http.StatusOK,
+		Data:       changes,
+	})
+}
+
+func restoreRevisionHandler(ctx *gin.Context) {
+	version, err := helpers.IfMatch(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: helpers.PreconditionStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+	fixture, err := restoreRevision(models.AuditActorFromContext(ctx), ctx.Param("id"), version, ctx.Param("revision"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: helpers.PreconditionStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+
+	ctx.Header("ETag", helpers.ETag(fixture.Version))
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully restored fixture",
+		StatusCode: http.StatusOK,
+		Data:       fixture,
+	})
+}
+
+func getFixtureTrashHandler(ctx *gin.Context) {
+	fixtures, total, page, perPage, err := getTrash(ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched deleted fixtures",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     fixtures,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func undeleteFixtureHandler(ctx *gin.Context) {
+	fixture, err := undeleteFixture(models.AuditActorFromContext(ctx), ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully restored fixture",
+		StatusCode: http.StatusOK,
+		Data:       fixture,
+	})
+}
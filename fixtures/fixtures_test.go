@@ -3,11 +3,14 @@ package fixtures
 import (
 	"context"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"league/models"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	// "go.mongodb.org/mongo-driver/bson"
 	// "go.mongodb.org/mongo-driver/bson/primitive"
@@ -58,6 +61,7 @@ func setupTestEnvironment(t *testing.T) {
 
 	// Set up the database and collection
 	fixtureCollection = client.Database(testDatabase).Collection("fixtures")
+	revisionCollection = client.Database(testDatabase).Collection("fixture_revisions")
 }
 
 func cleanupTestEnvironment(t *testing.T) {
@@ -164,7 +168,7 @@ func TestCreateFixture(t *testing.T) {
 	}
 
 	// Call the createFixture function
-	dbfixture, err := createFixture(fixture)
+	dbfixture, err := createFixture(models.AuditActor{}, fixture)
 	assert.NoError(t, err)
 	assert.NotNil(t, dbfixture)
 
@@ -237,12 +241,33 @@ func TestDeleteFixture_Success(t *testing.T) {
 	defer cleanupTestEnvironment(t)
 
 	// Call the deleteTeam function
-	err := deleteFixture("6606b1acda826498e1205a47")
+	err := deleteFixture(models.AuditActor{}, "6606b1acda826498e1205a47")
 
 	// Assert that the function returns no error
 	assert.NoError(t, err)
 }
 
+func TestUndeleteFixture_Success(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	created := createTestFixture(t)
+
+	// a fixture that is not in the trash cannot be restored
+	_, err := undeleteFixture(models.AuditActor{}, created.ID.Hex())
+	assert.Error(t, err)
+
+	assert.NoError(t, deleteFixture(models.AuditActor{}, created.ID.Hex()))
+
+	fixture, err := undeleteFixture(models.AuditActor{}, created.ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, fixture.ID)
+	assert.True(t, fixture.DeletedAt.IsZero())
+
+	_, err = undeleteFixture(models.AuditActor{}, created.ID.Hex())
+	assert.Error(t, err)
+}
+
 func TestUpdateFixture_Success(t *testing.T) {
 	// Set up test environment
 	setupTestEnvironment(t)
@@ -272,7 +297,7 @@ func TestUpdateFixture_Success(t *testing.T) {
 	}
 
 	// Call the updatefixture function
-	resp, err := updateFixture("6606b1acda826498e1205a47", update)
+	resp, err := updateFixture(models.AuditActor{}, "6606b1acda826498e1205a47", models.AnyVersion, update)
 
 	// Assert that the function returns no error and the updatedTeam is not nil
 	assert.NoError(t, err)
@@ -321,7 +346,7 @@ func TestUpdateFixtureStats_Success(t *testing.T) {
 	}
 
 	// Call the updatefixture function
-	resp, err := updateFixtureStats("6606b1acda826498e1205a47", update)
+	resp, err := updateFixtureStats(models.AuditActor{}, "6606b1acda826498e1205a47", models.AnyVersion, update)
 
 	// Assert that the function returns no error and the updatedTeam is not nil
 	assert.NoError(t, err)
@@ -377,3 +402,137 @@ func TestGetFixtures_Success(t *testing.T) {
 	assert.NotNil(t, fixtures)
 	assert.Greater(t, len(fixtures), 0)
 }
+
+// createTestFixture creates a fixture of its own, with the teams and competition the other tests use
+func createTestFixture(t *testing.T) *models.Fixture {
+	competitionID, err := primitive.ObjectIDFromHex("6606af2f8ea9f277021e23ea")
+	assert.NoError(t, err)
+	team1ID, err := primitive.ObjectIDFromHex("660595c06c25f01f95f72670")
+	assert.NoError(t, err)
+	team2ID, err := primitive.ObjectIDFromHex("6605964e0c3b6abc49e55641")
+	assert.NoError(t, err)
+
+	link, err := generateRandomString(50)
+	assert.NoError(t, err)
+
+	fixture, err := createFixture(models.AuditActor{}, models.Fixture{
+		HomeTeamID:    team1ID,
+		AwayTeamID:    team2ID,
+		CompetitionID: competitionID,
+		Status:        models.Pending,
+		Date:          time.Now(),
+		Stadium:       "emirates",
+		Referee:       "john snow",
+		UniqueLink:    link,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Error creating fixture: %v", err)
+	}
+	return fixture
+}
+
+func TestFixtureHistory(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	fixture := createTestFixture(t)
+	updated, err := updateFixture(models.AuditActor{}, fixture.ID.Hex(), fixture.Version, UpdateFixture{Referee: "jon snow"})
+	assert.NoError(t, err)
+
+	// revisions are numbered after the version they hold, newest first
+	revisions, total, _, _, err := getHistory(fixture.ID.Hex(), "1", "15")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, int(updated.Version)+1, revisions[0].Revision)
+	assert.Equal(t, models.RevisionUpdate, revisions[0].Change)
+	assert.Equal(t, "jon snow", revisions[0].Snapshot.Referee)
+	assert.Equal(t, 1, revisions[1].Revision)
+	assert.Equal(t, models.RevisionCreate, revisions[1].Change)
+	assert.Equal(t, "john snow", revisions[1].Snapshot.Referee)
+
+	revision, err := getRevision(fixture.ID.Hex(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, fixture.ID, revision.Snapshot.ID)
+
+	_, err = getRevision(fixture.ID.Hex(), "0")
+	assert.Error(t, err)
+	_, err = getRevision(fixture.ID.Hex(), "99")
+	assert.Error(t, err)
+}
+
+func TestDiffRevisions(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	fixture := createTestFixture(t)
+	_, err := updateFixture(models.AuditActor{}, fixture.ID.Hex(), fixture.Version, UpdateFixture{Referee: "jon snow"})
+	assert.NoError(t, err)
+
+	changes, err := diffRevisions(fixture.ID.Hex(), "1", "2")
+	assert.NoError(t, err)
+	assert.Contains(t, changes, models.AuditChange{Field: "referee", Before: "john snow", After: "jon snow"})
+	for _, change := range changes {
+		assert.NotEqual(t, "stadium", change.Field)
+	}
+
+	_, err = diffRevisions(fixture.ID.Hex(), "1", "99")
+	assert.Error(t, err)
+}
+
+func TestRestoreRevision(t *testing.T) {
+	setupTestEnvironment(t)
+	defer cleanupTestEnvironment(t)
+
+	fixture := createTestFixture(t)
+	updated, err := updateFixture(models.AuditActor{}, fixture.ID.Hex(), fixture.Version, UpdateFixture{Referee: "jon snow", Status: models.Completed})
+	assert.NoError(t, err)
+
+	// a restore made against a version that has since been edited is refused
+	_, err = restoreRevision(models.AuditActor{}, fixture.ID.Hex(), fixture.Version, "1")
+	assert.Equal(t, models.ErrVersionMismatch, err)
+
+	restored, err := restoreRevision(models.AuditActor{}, fixture.ID.Hex(), updated.Version, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "john snow", restored.Referee)
+	assert.Equal(t, models.Pending, restored.Status)
+	assert.Equal(t, fixture.UniqueLink, restored.UniqueLink)
+	assert.Equal(t, updated.Version+1, restored.Version)
+
+	// the restore is a revision of its own that remembers where it came from
+	revisions, total, _, _, err := getHistory(fixture.ID.Hex(), "1", "15")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, int(restored.Version)+1, revisions[0].Revision)
+	assert.Equal(t, models.RevisionRestore, revisions[0].Change)
+	assert.Equal(t, 1, revisions[0].RestoredFrom)
+
+	_, err = restoreRevision(models.AuditActor{}, fixture.ID.Hex(), models.AnyVersion, "99")
+	assert.Error(t, err)
+}
+
+func TestRestoreRevisionHandler_RequiresIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+	restoreRevisionHandler(ctx)
+	assert.Equal(t, http.StatusPreconditionRequired, recorder.Code)
+}
+
+func TestLineupPublished(t *testing.T) {
+	lineup := make([]string, 11)
+	update := UpdateFixtureStats{Home: Stats{Lineup: lineup}}
+
+	// the first lineup sent through the stats endpoint is published
+	assert.True(t, lineupPublished(models.Fixture{Home: models.Details{Lineup: lineup}}, update))
+	assert.False(t, lineupPublished(models.Fixture{}, UpdateFixtureStats{Home: Stats{Goals: 1}}))
+
+	// after that, edits do not announce it again unless a side had none
+	published := models.Fixture{LineupPublishedAt: time.Now(), Home: models.Details{Lineup: lineup}}
+	assert.False(t, lineupPublished(published, update))
+	assert.True(t, lineupPublished(published, UpdateFixtureStats{Away: Stats{Lineup: lineup}}))
+}
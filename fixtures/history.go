@@ -0,0 +1,255 @@
+package fixtures
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/audit"
+	"league/db"
+	"league/events"
+	"league/models"
+
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var revisionCollection *mongo.Collection = db.GetCollection(db.MongoClient, "fixture_revisions")
+
+func init() {
+	//check for revision index, one document per fixture and revision number
+	exists, err := db.IsIndexExists(context.Background(), revisionCollection, "fixture_id")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+	} else if !exists {
+		err = db.IndexUniqueCompound(*revisionCollection, bson.D{{Key: "fixture_id", Value: 1}, {Key: "revision", Value: -1}})
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+		}
+	}
+
+	// a change is only saved together with its revision
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureCreated) error {
+		return recordRevision(ctx, e.Actor, models.Fixture{}, e.Fixture, models.RevisionCreate, 0)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureUpdated) error {
+		return recordRevision(ctx, e.Actor, e.Before, e.After, models.RevisionUpdate, 0)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureStatsUpdated) error {
+		return recordRevision(ctx, e.Actor, e.Before, e.After, models.RevisionStats, 0)
+	})
+	events.SubscribeInTransaction(func(ctx context.Context, e events.FixtureRestored) error {
+		return recordRevision(ctx, e.Actor, e.Before, e.After, models.RevisionRestore, e.Revision)
+	})
+}
+
+// revisionNumber is the revision a fixture is stored as, its version plus one so the version it is created with is revision 1.
+// Two edits cannot both save the same version, so they cannot take the same revision either
+func revisionNumber(fixture models.Fixture) int {
+	return int(fixture.Version) + 1
+}
+
+// recordRevision stores the fixture as it is after a change, in the transaction that makes the change;
+// fixtures from before history was kept first get their previous state stored as a baseline so it can still be restored
+func recordRevision(ctx context.Context, actor models.AuditActor, before models.Fixture, after models.Fixture, change models.RevisionChange, restoredFrom int) error {
+	revisions := make([]interface{}, 0, 2)
+	if !before.ID.IsZero() {
+		latest, err := latestRevision(ctx, after.ID)
+		if err != nil {
+			return err
+		}
+		if latest == 0 {
+			revisions = append(revisions, models.FixtureRevision{
+				FixtureID: after.ID,
+				Revision:  revisionNumber(before),
+				Change:    models.RevisionBaseline,
+				Snapshot:  before,
+				CreatedAt: before.UpdatedAt,
+			})
+		}
+	}
+	revisions = append(revisions, models.FixtureRevision{
+		FixtureID:      after.ID,
+		Revision:       revisionNumber(after),
+		Change:         change,
+		Snapshot:       after,
+		EditorID:       actor.UserID,
+		ImpersonatedID: actor.ImpersonatedID,
+		RestoredFrom:   restoredFrom,
+		CreatedAt:      time.Now(),
+	})
+
+	_, err := revisionCollection.InsertMany(ctx, revisions)
+	if err != nil {
+		return fmt.Errorf("could not save fixture revision: %w", err)
+	}
+	return nil
+}
+
+func latestRevision(ctx context.Context, fixtureID primitive.ObjectID) (int, error) {
+	var revision models.FixtureRevision
+	err := revisionCollection.FindOne(ctx,
+		bson.M{"fixture_id": fixtureID},
+		options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}}).SetProjection(bson.M{"revision": 1}),
+	).Decode(&revision)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch fixture revisions: %w", err)
+	}
+	return revision.Revision, nil
+}
+
+// getHistory lists a fixture's revisions, newest first
+func getHistory(ID string, pageNumber string, pageSize string) ([]models.FixtureRevision, int64, int64, int64, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	perPage := int64(15)
+	page := int64(1)
+
+	if pageSize != "" {
+		if perPageNum, err := strconv.Atoi(pageSize); err == nil {
+			perPage = int64(perPageNum)
+		}
+	}
+
+	if pageNumber != "" {
+		if num, err := strconv.Atoi(pageNumber); err == nil {
+			page = int64(num)
+		}
+	}
+
+	offset := (page - 1) * perPage
+	filter := bson.M{"fixture_id": objID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	fOpt := options.FindOptions{Limit: &perPage, Skip: &offset, Sort: bson.D{{Key: "revision", Value: -1}}}
+
+	total, err := revisionCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to count fixture revisions: %v", err)
+	}
+
+	cursor, err := revisionCollection.Find(ctx, filter, &fOpt)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to find fixture revisions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	revisions := make([]models.FixtureRevision, 0)
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to decode fixture revisions: %v", err)
+	}
+
+	return revisions, total, page, perPage, nil
+}
+
+// getRevision returns the fixture as it was at one revision
+func getRevision(ID string, revision string) (*models.FixtureRevision, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+	number, err := strconv.Atoi(revision)
+	if err != nil || number < 1 {
+		return nil, fmt.Errorf("invalid revision: %v", revision)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var result models.FixtureRevision
+	err = revisionCollection.FindOne(ctx, bson.M{"fixture_id": objID, "revision": number}).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("fixture %v has no revision %v", ID, number)
+		}
+		return nil, fmt.Errorf("failed to fetch fixture revision: %v", err)
+	}
+	return &result, nil
+}
+
+// diffRevisions lists the fields that changed from one revision to another
+func diffRevisions(ID string, from string, to string) ([]models.AuditChange, error) {
+	older, err := getRevision(ID, from)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := getRevision(ID, to)
+	if err != nil {
+		return nil, err
+	}
+	return audit.Diff(older.Snapshot, newer.Snapshot)
+}
+
+// restoreRevision puts the fixture back the way it was at an earlier revision; the restore is itself a new revision
+// and, like any edit, only applies to the version the client last saw
+func restoreRevision(actor models.AuditActor, ID string, version int64, revision string) (*models.Fixture, error) {
+	target, err := getRevision(ID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var current models.Fixture
+	if err := fixtureCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": target.FixtureID})).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no fixture found with ID %s", ID)
+		}
+		return nil, fmt.Errorf("failed to fetch fixture: %v", err)
+	}
+	if version != models.AnyVersion && version != current.Version {
+		return nil, models.ErrVersionMismatch
+	}
+
+	// the link stays the one people already have, and the reschedule markers describe the current date
+	restored := target.Snapshot
+	restored.ID = current.ID
+	restored.UniqueLink = current.UniqueLink
+	restored.CreatedAt = current.CreatedAt
+	restored.UpdatedAt = time.Now()
+	restored.Version = current.Version + 1
+	restored.PreviousDate = current.PreviousDate
+	restored.RescheduledAt = current.RescheduledAt
+	if !restored.Date.Equal(current.Date) {
+		restored.PreviousDate = current.Date
+		restored.RescheduledAt = time.Now()
+	}
+
+	// the teams or competition of an old revision may have been deleted since
+	var fixture models.Fixture
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		if err := checkReferences(ctx, restored.CompetitionID, restored.HomeTeamID, restored.AwayTeamID); err != nil {
+			return fmt.Errorf("cannot restore revision %v: %w", target.Revision, err)
+		}
+		result, err := fixtureCollection.ReplaceOne(ctx, db.AtVersion(bson.M{"_id": current.ID}, current.Version), restored)
+		if err != nil {
+			return fmt.Errorf("could not restore fixture: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return models.ErrVersionMismatch
+		}
+		if err := fixtureCollection.FindOne(ctx, bson.M{"_id": current.ID}).Decode(&fixture); err != nil {
+			return fmt.Errorf("failed to fetch restored fixture: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.FixtureRestored{Actor: actor, Before: current, After: fixture, Revision: target.Revision})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events.PublishCommitted(events.FixtureRestored{Actor: actor, Before: current, After: fixture, Revision: target.Revision})
+	publishChanges(current, fixture)
+	return &fixture, nil
+}
@@ -148,4 +148,5 @@ type Fixture struct {
 	Referee       string             `bson:"referee" json:"referee"`
 	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+	Version       int64              `bson:"version" json:"version"`
 }
@@ -3,13 +3,10 @@ package fixtures
 import (
 	"github.com/gin-gonic/gin"
 
-	"league/jwt" //remove during unit tests
 	"league/middleware"
 	"league/models"
 )
 
-var admins []models.Role = []models.Role{models.AdminRole, models.SuperAdminRole}
-
 // New registers the routes and returns the router.
 func FixtureRoutes(superRoute *gin.RouterGroup) {
 	fixtureRouter := superRoute.Group("/fixtures")
@@ -18,15 +15,21 @@ func FixtureRoutes(superRoute *gin.RouterGroup) {
 		fixtureRouter.GET("/", searchHandler)
 
 		//protected
-		fixtureRouter.Use(jwt.Middleware())
-		fixtureRouter.POST("/", middleware.RolesMiddleware(admins), createFixtureHandler)
-		fixtureRouter.POST("/hash", middleware.RolesMiddleware(admins), generateUniqueHash)
+		fixtureRouter.Use(middleware.Authenticate())
+		fixtureRouter.POST("/", middleware.RequirePermission(models.FixturesWrite), createFixtureHandler)
+		fixtureRouter.POST("/hash", middleware.RequirePermission(models.FixturesWrite), generateUniqueHash)
 		fixtureRouter.GET("/status/:status", viewFixturesByTypeHandler)
 		fixtureRouter.GET("/:link", getFixtureByHash)
 		fixtureRouter.GET("/fixture/:id", singleFixtureHandler)
-		fixtureRouter.PATCH("/:id", middleware.RolesMiddleware(admins), updateFixtureHandler)
-		fixtureRouter.PATCH("/stats/:id", middleware.RolesMiddleware(admins), updateFixtureStatsHandler)
-		fixtureRouter.DELETE("/:id", middleware.RolesMiddleware(admins), deleteFixtureHandler)
+		fixtureRouter.GET("/fixture/:id/history", getHistoryHandler)
+		fixtureRouter.GET("/fixture/:id/history/diff", diffRevisionsHandler)
+		fixtureRouter.GET("/fixture/:id/history/:revision", getRevisionHandler)
+		fixtureRouter.POST("/fixture/:id/history/:revision/restore", middleware.RequirePermission(models.FixturesWrite), restoreRevisionHandler)
+		fixtureRouter.PATCH("/:id", middleware.RequirePermission(models.FixturesWrite), updateFixtureHandler)
+		fixtureRouter.PATCH("/stats/:id", middleware.RequirePermission(models.FixturesStats), updateFixtureStatsHandler)
+		fixtureRouter.DELETE("/:id", middleware.RequirePermission(models.FixturesDelete), deleteFixtureHandler)
+		fixtureRouter.GET("/trash", middleware.RequirePermission(models.FixturesDelete), getFixtureTrashHandler)
+		fixtureRouter.POST("/:id/restore", middleware.RequirePermission(models.FixturesDelete), undeleteFixtureHandler)
 		fixtureRouter.GET("/competitions", getCompetitionsHandler)
 		fixtureRouter.GET("/competitions/:id", getSingleCompetitionsHandler)
 	}
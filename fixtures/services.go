@@ -7,6 +7,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"league/db"
+	"league/events"
+	"league/integrity"
 	"league/models"
 
 	"crypto/rand"
@@ -148,10 +150,26 @@ func generateRandomString(length int) (string, error) {
 	return randomString, nil
 }
 
-func createFixture(fixture models.Fixture) (*models.Fixture, error) {
+func createFixture(actor models.AuditActor, fixture models.Fixture) (*models.Fixture, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
-	result, err := fixtureCollection.InsertOne(ctx, fixture)
+
+	// the teams and competition cannot be deleted between the check and the insert
+	var inserted models.Fixture
+	err := db.Transaction(ctx, func(ctx context.Context) error {
+		if err := checkReferences(ctx, fixture.CompetitionID, fixture.HomeTeamID, fixture.AwayTeamID); err != nil {
+			return err
+		}
+		result, err := fixtureCollection.InsertOne(ctx, fixture)
+		if err != nil {
+			return err
+		}
+		err = fixtureCollection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&inserted)
+		if err != nil {
+			return fmt.Errorf("failed to fetch inserted fixture: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.FixtureCreated{Actor: actor, Fixture: inserted})
+	})
 	if err != nil {
 		//check for duplicates
 		if mongoErr, ok := err.(mongo.WriteException); ok {
@@ -163,16 +181,38 @@ func createFixture(fixture models.Fixture) (*models.Fixture, error) {
 		}
 		return nil, err
 	}
-	var inserted models.Fixture
-	err = fixtureCollection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&inserted)
-	if err != nil {
-		// Handle error
-		return nil, fmt.Errorf("failed to fetch inserted fixture: %v", err)
-	}
 
+	events.PublishCommitted(events.FixtureCreated{Actor: actor, Fixture: inserted})
 	return &inserted, nil
 }
 
+// checkReferences makes sure a fixture is played by two different teams that exist, in a competition that exists
+func checkReferences(ctx context.Context, competitionID primitive.ObjectID, homeTeamID primitive.ObjectID, awayTeamID primitive.ObjectID) error {
+	if homeTeamID == awayTeamID {
+		return fmt.Errorf("home and away teams must be different")
+	}
+	if err := integrity.Require(ctx, "competitions", competitionID); err != nil {
+		return err
+	}
+	return integrity.Require(ctx, "teams", homeTeamID, awayTeamID)
+}
+
+// publishChanges sends the narrower events for whatever differs between two versions of a fixture
+func publishChanges(before models.Fixture, after models.Fixture) {
+	if !after.Date.Equal(before.Date) {
+		events.PublishCommitted(events.FixtureRescheduled{Fixture: after, PreviousDate: before.Date})
+	}
+	if after.Status != before.Status {
+		events.PublishCommitted(events.FixtureStatusChanged{Fixture: after, PreviousStatus: before.Status})
+	}
+	if after.Home.Goals != before.Home.Goals || after.Away.Goals != before.Away.Goals {
+		events.PublishCommitted(events.FixtureScoreChanged{Fixture: after, PreviousHome: before.Home.Goals, PreviousAway: before.Away.Goals})
+	}
+	if !after.LineupPublishedAt.Equal(before.LineupPublishedAt) {
+		events.PublishCommitted(events.LineupPublished{Fixture: after})
+	}
+}
+
 func getFixturesByStatus(status string, pageNumber string, pageSize string) ([]models.Fixture, int64, int64, int64, error) {
 	perPage := int64(15)
 	page := int64(1)
@@ -190,7 +230,7 @@ func getFixturesByStatus(status string, pageNumber string, pageSize string) ([]m
 	}
 	offset := (page - 1) * perPage
 
-	filter := bson.M{"status": status}
+	filter := db.NotDeleted(bson.M{"status": status})
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
@@ -237,7 +277,7 @@ func getFixtures(query SearchFeaturesRequest, pageNumber string, pageSize string
 
 	}
 
-	filter := bson.M{}
+	filter := db.NotDeleted(bson.M{})
 
 	if query.Query != "" {
 		regexQuery := bson.M{"$regex": query.Query, "$options": "i"}
@@ -323,7 +363,7 @@ func getSingleFixture(ID string) (*Fixture, error) {
 	}
 
 	pipeline := mongo.Pipeline{
-		{{"$match", bson.D{{"_id", objID}}}},
+		{{"$match", db.NotDeleted(bson.M{"_id": objID})}},
 		{{"$lookup", bson.D{
 			{"from", "competitions"},
 			{"localField", "competition_id"},
@@ -372,7 +412,7 @@ func getSingleFixtureByHash(hash string) (*Fixture, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 	pipeline := mongo.Pipeline{
-		{{"$match", bson.D{{"unique_link", hash}}}},
+		{{"$match", db.NotDeleted(bson.M{"unique_link": hash})}},
 		{{"$lookup", bson.D{
 			{"from", "competitions"},
 			{"localField", "competition_id"},
@@ -417,7 +457,7 @@ func getSingleFixtureByHash(hash string) (*Fixture, error) {
 	return &fixture, nil
 }
 
-func updateFixture(ID string, update UpdateFixture) (*models.Fixture, error) {
+func updateFixture(actor models.AuditActor, ID string, version int64, update UpdateFixture) (*models.Fixture, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
@@ -427,6 +467,15 @@ func updateFixture(ID string, update UpdateFixture) (*models.Fixture, error) {
 		return nil, fmt.Errorf("invalid ObjectID: %v", err)
 	}
 
+	// the current fixture tells us whether it was rescheduled or changed status
+	var current models.Fixture
+	if err := fixtureCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": objID})).Decode(&current); err != nil {
+		return nil, fmt.Errorf("failed to fetch fixture: %v", err)
+	}
+	if version != models.AnyVersion && version != current.Version {
+		return nil, models.ErrVersionMismatch
+	}
+
 	// Create update fields
 	updates := bson.M{}
 	if update.CompetitionID != primitive.NilObjectID {
@@ -440,6 +489,12 @@ func updateFixture(ID string, update UpdateFixture) (*models.Fixture, error) {
 	}
 	if !update.Date.IsZero() {
 		updates["date"] = update.Date
+
+		// remember the old date so followers can be told the fixture moved
+		if !current.Date.Equal(update.Date) {
+			updates["previous_date"] = current.Date
+			updates["rescheduled_at"] = time.Now()
+		}
 	}
 	if update.Status != "" {
 		updates["status"] = update.Status
@@ -451,24 +506,66 @@ func updateFixture(ID string, update UpdateFixture) (*models.Fixture, error) {
 		updates["referee"] = update.Referee
 	}
 
+	// when a reference changes the fixture is checked as it will be after the update
+	competitionID, homeTeamID, awayTeamID := current.CompetitionID, current.HomeTeamID, current.AwayTeamID
+	if update.CompetitionID != primitive.NilObjectID {
+		competitionID = update.CompetitionID
+	}
+	if update.HomeTeamID != primitive.NilObjectID {
+		homeTeamID = update.HomeTeamID
+	}
+	if update.AwayTeamID != primitive.NilObjectID {
+		awayTeamID = update.AwayTeamID
+	}
+	referencesChanged := competitionID != current.CompetitionID || homeTeamID != current.HomeTeamID || awayTeamID != current.AwayTeamID
+
 	// Add fields that are always updated
 	updates["updated_at"] = time.Now()
 
 	// Perform the update operation
-	_, err = fixtureCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": updates})
-	if err != nil {
-		return nil, fmt.Errorf("could not update link: %v", err)
-	}
-
 	var fixture models.Fixture
-	err = fixtureCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&fixture)
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		if referencesChanged {
+			if err := checkReferences(ctx, competitionID, homeTeamID, awayTeamID); err != nil {
+				return err
+			}
+		}
+		result, err := fixtureCollection.UpdateOne(ctx,
+			db.AtVersion(db.NotDeleted(bson.M{"_id": objID}), current.Version),
+			bson.M{"$set": updates, "$inc": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not update link: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return models.ErrVersionMismatch
+		}
+		err = fixtureCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&fixture)
+		if err != nil {
+			return fmt.Errorf("failed to fetch updated fixture: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.FixtureUpdated{Actor: actor, Before: current, After: fixture})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch updated fixture: %v", err)
+		return nil, err
 	}
+
+	events.PublishCommitted(events.FixtureUpdated{Actor: actor, Before: current, After: fixture})
+	publishChanges(current, fixture)
 	return &fixture, nil
 }
 
-func updateFixtureStats(ID string, update UpdateFixtureStats) (*models.Fixture, error) {
+// lineupPublished reports whether the update publishes a lineup: the first one sent through the stats endpoint,
+// or one for a side that had none. Followers are told once, not again with every stats edit
+func lineupPublished(current models.Fixture, update UpdateFixtureStats) bool {
+	if current.LineupPublishedAt.IsZero() {
+		return len(update.Home.Lineup) > 0 || len(update.Away.Lineup) > 0
+	}
+	return len(update.Home.Lineup) > 0 && len(current.Home.Lineup) == 0 ||
+		len(update.Away.Lineup) > 0 && len(current.Away.Lineup) == 0
+}
+
+func updateFixtureStats(actor models.AuditActor, ID string, version int64, update UpdateFixtureStats) (*models.Fixture, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
@@ -478,6 +575,14 @@ func updateFixtureStats(ID string, update UpdateFixtureStats) (*models.Fixture,
 		return nil, fmt.Errorf("invalid ObjectID: %v", err)
 	}
 
+	var current models.Fixture
+	if err := fixtureCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": objID})).Decode(&current); err != nil {
+		return nil, fmt.Errorf("failed to fetch fixture: %v", err)
+	}
+	if version != models.AnyVersion && version != current.Version {
+		return nil, models.ErrVersionMismatch
+	}
+
 	updates := bson.M{
 		"updated_at": time.Now(),
 	}
@@ -602,21 +707,39 @@ func updateFixtureStats(ID string, update UpdateFixtureStats) (*models.Fixture,
 		updates["away.lineup"] = update.Away.Lineup
 	}
 
-	// Perform the update operation
-	_, err = fixtureCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": updates})
-	if err != nil {
-		return nil, fmt.Errorf("could not update link: %v", err)
+	if lineupPublished(current, update) {
+		updates["lineup_published_at"] = time.Now()
 	}
 
+	// Perform the update operation
 	var fixture models.Fixture
-	err = fixtureCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&fixture)
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		result, err := fixtureCollection.UpdateOne(ctx,
+			db.AtVersion(db.NotDeleted(bson.M{"_id": objID}), current.Version),
+			bson.M{"$set": updates, "$inc": bson.M{"version": 1}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not update link: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return models.ErrVersionMismatch
+		}
+		err = fixtureCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&fixture)
+		if err != nil {
+			return fmt.Errorf("failed to fetch updated fixture: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.FixtureStatsUpdated{Actor: actor, Before: current, After: fixture})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch updated fixture: %v", err)
+		return nil, err
 	}
+
+	events.PublishCommitted(events.FixtureStatsUpdated{Actor: actor, Before: current, After: fixture})
+	publishChanges(current, fixture)
 	return &fixture, nil
 }
 
-func deleteFixture(ID string) error {
+func deleteFixture(actor models.AuditActor, ID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
@@ -625,15 +748,26 @@ func deleteFixture(ID string) error {
 		return fmt.Errorf("invalid ObjectID: %v", err)
 	}
 
-	result, err := fixtureCollection.DeleteOne(ctx, bson.M{"_id": objId})
+	// the fixture goes to the trash, it can be restored until it is purged
+	var deleted models.Fixture
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		err := fixtureCollection.FindOneAndUpdate(ctx,
+			db.NotDeleted(bson.M{"_id": objId}),
+			bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+		).Decode(&deleted)
+		if err != nil {
+			return err
+		}
+		return events.PublishInTransaction(ctx, events.FixtureDeleted{Actor: actor, Fixture: deleted})
+	})
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("no fixture found with ID %s", ID)
+		}
 		return fmt.Errorf("failed to delete fixture: %v", err)
 	}
 
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("no fixture found with ID %s", ID)
-	}
-
+	events.PublishCommitted(events.FixtureDeleted{Actor: actor, Fixture: deleted})
 	return nil
 }
 
@@ -705,3 +839,32 @@ func getSingleCompetition(ID string) (*models.Competition, error) {
 
 	return &competition, nil
 }
+
+// checkFixtureAccess makes sure club admins only touch fixtures their club plays in
+func checkFixtureAccess(user *models.User, ID string) error {
+	if !user.IsClubScoped() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	var fixture models.Fixture
+	err = fixtureCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": objID})).Decode(&fixture)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("no fixture found with ID %s", ID)
+		}
+		return fmt.Errorf("failed to fetch fixture: %v", err)
+	}
+
+	if !user.ManagesTeam(fixture.HomeTeamID) && !user.ManagesTeam(fixture.AwayTeamID) {
+		return models.ErrNotClubAdmin
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package fixtures
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/events"
+	"league/integrity"
+	"league/models"
+
+	"context"
+	"fmt"
+	"time"
+)
+
+// getTrash lists deleted fixtures that can still be restored, most recently deleted first
+func getTrash(pageNumber string, pageSize string) ([]models.Fixture, int64, int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	fixtures := make([]models.Fixture, 0)
+	total, page, perPage, err := db.TrashPage(ctx, fixtureCollection, bson.M{}, pageNumber, pageSize, &fixtures)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+	return fixtures, total, page, perPage, nil
+}
+
+// undeleteFixture takes a fixture back out of the trash
+func undeleteFixture(actor models.AuditActor, ID string) (*models.Fixture, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var fixture models.Fixture
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		var deleted models.Fixture
+		if err := fixtureCollection.FindOne(ctx, db.Deleted(bson.M{"_id": objID})).Decode(&deleted); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("no deleted fixture found with ID %s", ID)
+			}
+			return fmt.Errorf("failed to fetch fixture: %w", err)
+		}
+		// its teams or competition may have been deleted while it was in the trash
+		if err := checkReferences(ctx, deleted.CompetitionID, deleted.HomeTeamID, deleted.AwayTeamID); err != nil {
+			return fmt.Errorf("cannot restore fixture: %w", err)
+		}
+
+		err := fixtureCollection.FindOneAndUpdate(ctx,
+			db.Deleted(bson.M{"_id": objID}),
+			bson.M{"$unset": bson.M{"deleted_at": ""}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&fixture)
+		if err != nil {
+			return fmt.Errorf("could not restore fixture: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.FixtureUndeleted{Actor: actor, Fixture: fixture})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events.PublishCommitted(events.FixtureUndeleted{Actor: actor, Fixture: fixture})
+	return &fixture, nil
+}
+
+// purgeTrash permanently removes fixtures once they have outlived the retention period, together with whatever
+// their relations cascade to, their history included
+func purgeTrash() {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	cursor, err := fixtureCollection.Find(ctx, db.Expired(time.Now()), options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		fmt.Printf("failed to find expired fixtures: %v \n", err)
+		return
+	}
+	var expired []models.Fixture
+	if err := cursor.All(ctx, &expired); err != nil {
+		fmt.Printf("failed to decode expired fixtures: %v \n", err)
+		return
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	IDs := make([]primitive.ObjectID, 0, len(expired))
+	for _, fixture := range expired {
+		IDs = append(IDs, fixture.ID)
+	}
+
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		for _, ID := range IDs {
+			if err := integrity.ApplyDelete(ctx, "fixtures", ID); err != nil {
+				return err
+			}
+		}
+		if _, err := fixtureCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": IDs}}); err != nil {
+			return fmt.Errorf("failed to purge fixtures: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("%v \n", err)
+	}
+}
+
+// StartPurgeWorker periodically removes fixtures that have been in the trash past the retention period
+func StartPurgeWorker() {
+	db.StartPurging(purgeTrash)
+}
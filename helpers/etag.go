@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"league/models"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrPreconditionRequired is returned when an update does not say which version it was made against
+var ErrPreconditionRequired = errors.New("send the ETag you last read in the If-Match header")
+
+// ETag formats a document version as a strong entity tag
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ContentETag tags a read that embeds other documents: the version, which If-Match still accepts,
+// followed by a hash of the body so the tag also changes when an embedded document does
+func ContentETag(version int64, body interface{}) string {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return ETag(version)
+	}
+	sum := sha256.Sum256(data)
+	return `"` + strconv.FormatInt(version, 10) + "-" + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// NotModified sets the ETag of a read and answers 304 when If-None-Match already has that version;
+// the handler stops when it returns true
+func NotModified(ctx *gin.Context, version int64) bool {
+	return NotModifiedTag(ctx, ETag(version))
+}
+
+// NotModifiedTag is NotModified for a tag from ContentETag
+func NotModifiedTag(ctx *gin.Context, etag string) bool {
+	ctx.Header("ETag", etag)
+
+	for _, tag := range strings.Split(ctx.GetHeader("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			ctx.AbortWithStatus(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// IfMatch returns the version an update was made against, models.AnyVersion for If-Match: *
+func IfMatch(ctx *gin.Context) (int64, error) {
+	header := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if header == "" {
+		return 0, ErrPreconditionRequired
+	}
+	if header == "*" {
+		return models.AnyVersion, nil
+	}
+
+	// only the version of a tag from ContentETag matters for an update
+	tag, _, _ := strings.Cut(strings.Trim(header, `"`), "-")
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 0 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return 0, fmt.Errorf("%v is not an ETag from this API", header)
+	}
+	return version, nil
+}
+
+// PreconditionStatus is the status for an error from IfMatch or from an update made against an old version
+func PreconditionStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrPreconditionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, models.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusBadRequest
+}
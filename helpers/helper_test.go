@@ -2,8 +2,13 @@ package helpers
 
 import (
 	"testing"
+	"net/http"
+	"net/http/httptest"
 	"golang.org/x/crypto/bcrypt"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+
+	"league/models"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -35,3 +40,82 @@ func TestCheckPasswordHash(t *testing.T) {
 	// Assert that the password and hash match
 	assert.True(t, match)
 }
+
+func newETagContext(header string, value string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if value != "" {
+		ctx.Request.Header.Set(header, value)
+	}
+	return ctx, recorder
+}
+
+func TestIfMatch(t *testing.T) {
+	// A missing header asks the client to send one
+	ctx, _ := newETagContext("If-Match", "")
+	_, err := IfMatch(ctx)
+	assert.Equal(t, http.StatusPreconditionRequired, PreconditionStatus(err))
+
+	ctx, _ = newETagContext("If-Match", `"3"`)
+	version, err := IfMatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+
+	// tags of reads that embed other documents carry a hash after the version
+	ctx, _ = newETagContext("If-Match", `"3-9f86d081884c7d65"`)
+	version, err = IfMatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+
+	ctx, _ = newETagContext("If-Match", `"-3"`)
+	_, err = IfMatch(ctx)
+	assert.Equal(t, http.StatusBadRequest, PreconditionStatus(err))
+
+	ctx, _ = newETagContext("If-Match", "*")
+	version, err = IfMatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AnyVersion, version)
+
+	// Unquoted or foreign tags are rejected
+	ctx, _ = newETagContext("If-Match", "3")
+	_, err = IfMatch(ctx)
+	assert.Equal(t, http.StatusBadRequest, PreconditionStatus(err))
+
+	assert.Equal(t, http.StatusPreconditionFailed, PreconditionStatus(models.ErrVersionMismatch))
+}
+
+func TestNotModified(t *testing.T) {
+	ctx, recorder := newETagContext("If-None-Match", `"1", W/"2"`)
+	assert.True(t, NotModified(ctx, 2))
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Equal(t, `"2"`, recorder.Header().Get("ETag"))
+
+	ctx, _ = newETagContext("If-None-Match", `"1"`)
+	assert.False(t, NotModified(ctx, 2))
+	assert.Equal(t, `"2"`, ctx.Writer.Header().Get("ETag"))
+}
+
+func TestContentETag(t *testing.T) {
+	type team struct{ Name string }
+	type fixture struct {
+		Version int64
+		Home    team
+	}
+	before := ContentETag(2, fixture{Version: 2, Home: team{Name: "Rovers"}})
+	assert.Regexp(t, `^"2-[0-9a-f]{16}"$`, before)
+	assert.Equal(t, before, ContentETag(2, fixture{Version: 2, Home: team{Name: "Rovers"}}))
+
+	// renaming an embedded team changes the tag although the fixture's version did not
+	after := ContentETag(2, fixture{Version: 2, Home: team{Name: "United"}})
+	assert.NotEqual(t, before, after)
+
+	ctx, recorder := newETagContext("If-None-Match", before)
+	assert.True(t, NotModifiedTag(ctx, before))
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+
+	ctx, _ = newETagContext("If-None-Match", before)
+	assert.False(t, NotModifiedTag(ctx, after))
+	assert.Equal(t, after, ctx.Writer.Header().Get("ETag"))
+}
@@ -0,0 +1,54 @@
+package integrity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"league/models"
+)
+
+func TestConfigure(t *testing.T) {
+	env := map[string]string{
+		"ON_DELETE_FIXTURE_HOME_TEAM": "Cascade",
+		"ON_DELETE_PLAYER_TEAM":       "delete",
+		"ON_DELETE_USER_CLUBS":        "cascade",
+	}
+	relations := configure(defaults, func(key string) string { return env[key] })
+
+	byName := map[string]models.OnDelete{}
+	for _, relation := range relations {
+		byName[relation.Name] = relation.OnDelete
+	}
+	assert.Equal(t, models.Cascade, byName["fixture.home_team"])
+	assert.Equal(t, models.Restrict, byName["fixture.away_team"])
+	// unknown behaviours and cascades on lists keep the default
+	assert.Equal(t, models.Nullify, byName["player.team"])
+	assert.Equal(t, models.Nullify, byName["user.clubs"])
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "ON_DELETE_FOLLOW_COMPETITIONS", envName("follow.competitions"))
+}
+
+func TestDefaults(t *testing.T) {
+	names := map[string]bool{}
+	for _, relation := range defaults {
+		assert.False(t, names[relation.Name], "%v is listed twice", relation.Name)
+		names[relation.Name] = true
+		assert.True(t, relation.OnDelete.IsValid(), relation.Name)
+		assert.False(t, relation.Many && relation.OnDelete == models.Cascade, relation.Name)
+	}
+	for _, name := range []string{"team.created_by", "webhook.created_by", "invite.invited_by", "fixture_revision.fixture"} {
+		assert.True(t, names[name], name)
+	}
+}
+
+func TestBumpVersion(t *testing.T) {
+	update := bumpVersion("players", bson.M{"$unset": bson.M{"team_id": ""}})
+	assert.Equal(t, bson.M{"$unset": bson.M{"team_id": ""}, "$inc": bson.M{"version": 1}}, update)
+
+	update = bumpVersion("users", bson.M{"$pull": bson.M{"clubs": bson.M{"$in": bson.A{}}}})
+	assert.NotContains(t, update, "$inc")
+}
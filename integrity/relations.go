@@ -0,0 +1,90 @@
+package integrity
+
+import (
+	"league/models"
+
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Relation is a field in one collection that holds the ID of a document in another
+type Relation struct {
+	Name       string `json:"name"`
+	Collection string `json:"collection"`
+	Field      string `json:"field"`
+	Target     string `json:"target"`
+	// Many is set when the field holds a list of IDs; those references can only be restricted or nullified
+	Many     bool            `json:"many"`
+	OnDelete models.OnDelete `json:"on_delete"`
+}
+
+// defaults are used unless ON_DELETE_<NAME> overrides them, e.g. ON_DELETE_PLAYER_TEAM=cascade
+var defaults = []Relation{
+	{Name: "fixture.competition", Collection: "fixtures", Field: "competition_id", Target: "competitions", OnDelete: models.Restrict},
+	{Name: "fixture.home_team", Collection: "fixtures", Field: "home_team_id", Target: "teams", OnDelete: models.Restrict},
+	{Name: "fixture.away_team", Collection: "fixtures", Field: "away_team_id", Target: "teams", OnDelete: models.Restrict},
+	{Name: "player.team", Collection: "players", Field: "team_id", Target: "teams", OnDelete: models.Nullify},
+	{Name: "user.clubs", Collection: "users", Field: "clubs", Target: "teams", Many: true, OnDelete: models.Nullify},
+	{Name: "follow.teams", Collection: "notification_preferences", Field: "teams", Target: "teams", Many: true, OnDelete: models.Nullify},
+	{Name: "follow.competitions", Collection: "notification_preferences", Field: "competitions", Target: "competitions", Many: true, OnDelete: models.Nullify},
+	// accounts are anonymised rather than removed when purged or erased, so these only find users removed by hand
+	{Name: "team.created_by", Collection: "teams", Field: "created_by", Target: "users", OnDelete: models.Nullify},
+	{Name: "webhook.created_by", Collection: "webhooks", Field: "created_by", Target: "users", OnDelete: models.Nullify},
+	{Name: "invite.invited_by", Collection: "invites", Field: "invited_by", Target: "users", OnDelete: models.Nullify},
+	// deleted fixtures keep their history in the trash, it is removed when they are purged
+	{Name: "fixture_revision.fixture", Collection: "fixture_revisions", Field: "fixture_id", Target: "fixtures", OnDelete: models.Cascade},
+}
+
+// Relations is every reference the integrity checks know about, with the delete behaviour in effect
+var Relations []Relation = configure(defaults, os.Getenv)
+
+// trashable collections are soft deleted, so cascading into them puts documents in the trash instead of removing them
+var trashable = map[string]bool{"fixtures": true, "teams": true, "users": true}
+
+// versioned collections serve their version as the ETag, every change to their documents has to bump it
+var versioned = map[string]bool{"fixtures": true, "teams": true, "players": true}
+
+func envName(relation string) string {
+	return "ON_DELETE_" + strings.ToUpper(strings.ReplaceAll(relation, ".", "_"))
+}
+
+func configure(relations []Relation, getenv func(string) string) []Relation {
+	configured := make([]Relation, 0, len(relations))
+	for _, relation := range relations {
+		if value := getenv(envName(relation.Name)); value != "" {
+			onDelete := models.OnDelete(strings.ToLower(value))
+			switch {
+			case !onDelete.IsValid():
+				fmt.Printf("ignoring %v: %v is not restrict, cascade or nullify \n", envName(relation.Name), value)
+			case relation.Many && onDelete == models.Cascade:
+				fmt.Printf("ignoring %v: %v holds a list and cannot cascade \n", envName(relation.Name), relation.Name)
+			default:
+				relation.OnDelete = onDelete
+			}
+		}
+		configured = append(configured, relation)
+	}
+	return configured
+}
+
+// GetRelation looks a relation up by name
+func GetRelation(name string) (Relation, error) {
+	for _, relation := range Relations {
+		if relation.Name == name {
+			return relation, nil
+		}
+	}
+	return Relation{}, fmt.Errorf("unknown relation %v", name)
+}
+
+// referencing lists the relations that point at a collection
+func referencing(target string) []Relation {
+	var relations []Relation
+	for _, relation := range Relations {
+		if relation.Target == target {
+			relations = append(relations, relation)
+		}
+	}
+	return relations
+}
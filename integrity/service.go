@@ -0,0 +1,290 @@
+package integrity
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/events"
+	"league/models"
+
+	"context"
+	"fmt"
+	"time"
+)
+
+var duration time.Duration = 10 * time.Second
+
+// reportLimit caps how many orphans the report lists per relation, the total is always exact
+const reportLimit = 50
+
+// nouns name one document of a collection in error messages
+var nouns = map[string]string{"teams": "team", "competitions": "competition", "fixtures": "fixture", "users": "user"}
+
+func noun(collection string) string {
+	if name, ok := nouns[collection]; ok {
+		return name
+	}
+	return collection
+}
+
+func collection(name string) *mongo.Collection {
+	return db.GetCollection(db.MongoClient, name)
+}
+
+// live narrows a filter to documents outside the trash, for collections that have one
+func live(collection string, filter bson.M) bson.M {
+	if trashable[collection] {
+		return db.NotDeleted(filter)
+	}
+	return filter
+}
+
+// Require checks that every ID points at an existing document of the target collection that is not in the trash;
+// run it in the same transaction as the write that stores the references.
+// Transactions only conflict on writes, so the documents are also written to: a delete running at the same time
+// writes them too, and one of the two transactions fails with a write conflict and is retried
+func Require(ctx context.Context, target string, IDs ...primitive.ObjectID) error {
+	if len(IDs) == 0 {
+		return nil
+	}
+
+	cursor, err := collection(target).Find(ctx,
+		live(target, bson.M{"_id": bson.M{"$in": IDs}}),
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check %v: %w", target, err)
+	}
+	var found []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return fmt.Errorf("failed to check %v: %w", target, err)
+	}
+
+	exists := make(map[primitive.ObjectID]bool, len(found))
+	for _, document := range found {
+		exists[document.ID] = true
+	}
+	for _, ID := range IDs {
+		if !exists[ID] {
+			return fmt.Errorf("%v %v does not exist", noun(target), ID.Hex())
+		}
+	}
+
+	// a fresh value each time, an update that changes nothing is not a write
+	_, err = collection(target).UpdateMany(ctx,
+		live(target, bson.M{"_id": bson.M{"$in": IDs}}),
+		bson.M{"$set": bson.M{"reference_lock": primitive.NewObjectID()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to lock %v: %w", target, err)
+	}
+	return nil
+}
+
+// CheckDelete refuses to delete a document that a restricted relation still points at
+func CheckDelete(ctx context.Context, target string, ID primitive.ObjectID) error {
+	for _, relation := range referencing(target) {
+		if relation.OnDelete != models.Restrict {
+			continue
+		}
+		count, err := collection(relation.Collection).CountDocuments(ctx, live(relation.Collection, bson.M{relation.Field: ID}))
+		if err != nil {
+			return fmt.Errorf("failed to check %v: %w", relation.Name, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%v is still referenced by %d %v through %v", noun(target), count, relation.Collection, relation.Name)
+		}
+	}
+	return nil
+}
+
+// ApplyDelete cascades or nullifies the references to a document that is being removed for good.
+// Run it when the document is purged rather than when it goes to the trash, so a restore finds its references intact
+func ApplyDelete(ctx context.Context, target string, ID primitive.ObjectID) error {
+	for _, relation := range referencing(target) {
+		filter := live(relation.Collection, bson.M{relation.Field: ID})
+		if _, err := apply(ctx, relation, relation.OnDelete, filter, []primitive.ObjectID{ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply carries out a delete behaviour on the documents matched by filter; IDs are the references being removed
+func apply(ctx context.Context, relation Relation, action models.OnDelete, filter bson.M, IDs []primitive.ObjectID) (int64, error) {
+	documents := collection(relation.Collection)
+
+	switch action {
+	case models.Nullify:
+		update := bson.M{"$unset": bson.M{relation.Field: ""}}
+		if relation.Many {
+			update = bson.M{"$pull": bson.M{relation.Field: bson.M{"$in": IDs}}}
+		}
+		result, err := documents.UpdateMany(ctx, filter, bumpVersion(relation.Collection, update))
+		if err != nil {
+			return 0, fmt.Errorf("could not nullify %v: %w", relation.Name, err)
+		}
+		return result.ModifiedCount, nil
+	case models.Cascade:
+		if trashable[relation.Collection] {
+			update := bson.M{"$set": bson.M{"deleted_at": time.Now()}}
+			result, err := documents.UpdateMany(ctx, db.NotDeleted(filter), bumpVersion(relation.Collection, update))
+			if err != nil {
+				return 0, fmt.Errorf("could not cascade %v: %w", relation.Name, err)
+			}
+			return result.ModifiedCount, nil
+		}
+		result, err := documents.DeleteMany(ctx, filter)
+		if err != nil {
+			return 0, fmt.Errorf("could not cascade %v: %w", relation.Name, err)
+		}
+		return result.DeletedCount, nil
+	}
+	return 0, nil
+}
+
+// bumpVersion adds a version increment to an update of a versioned collection,
+// so clients holding the old ETag see the change and cannot overwrite it
+func bumpVersion(collection string, update bson.M) bson.M {
+	if versioned[collection] {
+		update["$inc"] = bson.M{"version": 1}
+	}
+	return update
+}
+
+// Orphan is a document holding references to documents that no longer exist
+type Orphan struct {
+	ID      primitive.ObjectID   `bson:"_id" json:"_id"`
+	Missing []primitive.ObjectID `bson:"missing" json:"missing"`
+}
+
+// Check is the report for one relation
+type Check struct {
+	Relation Relation `json:"relation"`
+	Total    int      `json:"total"`
+	Orphans  []Orphan `json:"orphans"`
+}
+
+// Result is what a repair did to one relation
+type Result struct {
+	Relation string          `json:"relation"`
+	Action   models.OnDelete `json:"action"`
+	Repaired int64           `json:"repaired"`
+}
+
+// orphans finds live documents whose references point at nothing; a target in the trash still counts as existing
+func orphans(ctx context.Context, relation Relation) ([]Orphan, error) {
+	field := "$" + relation.Field
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: live(relation.Collection, bson.M{})}},
+		{{Key: "$unwind", Value: field}},
+		{{Key: "$match", Value: bson.M{relation.Field: bson.M{"$nin": bson.A{nil, primitive.NilObjectID}}}}},
+		{{Key: "$lookup", Value: bson.M{"from": relation.Target, "localField": relation.Field, "foreignField": "_id", "as": "target"}}},
+		{{Key: "$match", Value: bson.M{"target": bson.M{"$size": 0}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$_id", "missing": bson.M{"$push": field}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := collection(relation.Collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %v: %w", relation.Name, err)
+	}
+	found := make([]Orphan, 0)
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, fmt.Errorf("failed to decode orphans of %v: %w", relation.Name, err)
+	}
+	return found, nil
+}
+
+// Report lists the orphaned references of every relation
+func Report() ([]Check, error) {
+	checks := make([]Check, 0, len(Relations))
+	for _, relation := range Relations {
+		ctx, cancel := context.WithTimeout(context.Background(), duration)
+		found, err := orphans(ctx, relation)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		check := Check{Relation: relation, Total: len(found), Orphans: found}
+		if len(found) > reportLimit {
+			check.Orphans = found[:reportLimit]
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// Repair fixes the orphans of one relation, cascading or nullifying them; an empty action uses the relation's own
+func Repair(actor models.AuditActor, name string, action models.OnDelete) (*Result, error) {
+	relation, err := GetRelation(name)
+	if err != nil {
+		return nil, err
+	}
+	if action == "" {
+		action = relation.OnDelete
+	}
+	switch {
+	case !action.IsValid():
+		return nil, fmt.Errorf("%v is not restrict, cascade or nullify", action)
+	case action == models.Restrict:
+		return nil, fmt.Errorf("%v is restricted, repair it with cascade or nullify", relation.Name)
+	case relation.Many && action == models.Cascade:
+		return nil, fmt.Errorf("%v holds a list and cannot cascade", relation.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	result := Result{Relation: relation.Name, Action: action}
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		found, err := orphans(ctx, relation)
+		if err != nil || len(found) == 0 {
+			return err
+		}
+
+		documentIDs := make([]primitive.ObjectID, 0, len(found))
+		missing := make([]primitive.ObjectID, 0, len(found))
+		for _, orphan := range found {
+			documentIDs = append(documentIDs, orphan.ID)
+			missing = append(missing, orphan.Missing...)
+		}
+
+		result.Repaired, err = apply(ctx, relation, action, bson.M{"_id": bson.M{"$in": documentIDs}}, missing)
+		if err != nil || result.Repaired == 0 {
+			return err
+		}
+		return events.PublishInTransaction(ctx, events.IntegrityRepaired{Actor: actor, Relation: relation.Name, Action: action, Repaired: result.Repaired})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Repaired == 0 {
+		return &result, nil
+	}
+
+	events.PublishCommitted(events.IntegrityRepaired{Actor: actor, Relation: relation.Name, Action: action, Repaired: result.Repaired})
+	return &result, nil
+}
+
+// RepairAll repairs every relation with its own delete behaviour; restricted relations are left for an admin to decide
+func RepairAll(actor models.AuditActor) ([]Result, error) {
+	results := make([]Result, 0, len(Relations))
+	for _, relation := range Relations {
+		if relation.OnDelete == models.Restrict {
+			continue
+		}
+		result, err := Repair(actor, relation.Name, "")
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
@@ -2,6 +2,8 @@ package jwt
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,10 +17,12 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 
+	"league/audit"
 	"league/db"
 	"league/helpers"
 	"league/models"
 	cisredis "league/redis"
+	"league/sessions"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -35,11 +39,19 @@ func init() {
 	SecretKey = []byte(secretKey)
 }
 
-func GenerateJWT(providerID primitive.ObjectID) (string, error) {
+// ErrNoSession is returned for tokens that are not tied to a session, signing out could not revoke them
+var ErrNoSession = fmt.Errorf("token is not tied to a session, please sign in again")
+
+// GenerateSessionJWT ties the token to a session so signing the session out revokes it
+func GenerateSessionJWT(providerID primitive.ObjectID, sessionID primitive.ObjectID) (string, error) {
+	if sessionID.IsZero() {
+		return "", ErrNoSession
+	}
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 	claims["authorized"] = true
 	claims["id"] = providerID
+	claims["sid"] = sessionID.Hex()
 	claims["exp"] = time.Now().Add(time.Minute * 30).Unix()
 	tokenString, err := token.SignedString(SecretKey)
 	if err != nil {
@@ -48,6 +60,70 @@ func GenerateJWT(providerID primitive.ObjectID) (string, error) {
 	return tokenString, nil
 }
 
+// ImpersonationTTL is how long an impersonation token lasts; it cannot be refreshed
+var ImpersonationTTL time.Duration = 15 * time.Minute
+
+// GenerateImpersonationJWT issues a token acting as the target that also names the impersonating super-admin;
+// it is tied to the super-admin's session so signing that session out ends the impersonation too
+func GenerateImpersonationJWT(targetID primitive.ObjectID, impersonatorID primitive.ObjectID, sessionID primitive.ObjectID) (string, error) {
+	if sessionID.IsZero() {
+		return "", ErrNoSession
+	}
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["authorized"] = true
+	claims["id"] = targetID
+	claims["imp"] = impersonatorID.Hex()
+	claims["sid"] = sessionID.Hex()
+	claims["exp"] = time.Now().Add(ImpersonationTTL).Unix()
+	return token.SignedString(SecretKey)
+}
+
+// GenerateLinkToken signs a short lived token for links sent by email; purpose keeps it from being used elsewhere
+func GenerateLinkToken(ID primitive.ObjectID, purpose string, ttl time.Duration) (string, string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+	jti := hex.EncodeToString(nonce)
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["sub"] = ID.Hex()
+	claims["purpose"] = purpose
+	claims["jti"] = jti
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	tokenString, err := token.SignedString(SecretKey)
+	if err != nil {
+		return "", "", err
+	}
+	return tokenString, jti, nil
+}
+
+// ParseLinkToken verifies a token made by GenerateLinkToken and returns its user ID and unique ID
+func ParseLinkToken(tokenString string, purpose string) (primitive.ObjectID, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return SecretKey, nil
+	})
+	if err != nil {
+		return primitive.NilObjectID, "", fmt.Errorf("invalid or expired link: %v", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != purpose {
+		return primitive.NilObjectID, "", fmt.Errorf("invalid link")
+	}
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims["sub"].(string)
+	ID, err := primitive.ObjectIDFromHex(sub)
+	if err != nil || jti == "" {
+		return primitive.NilObjectID, "", fmt.Errorf("invalid link")
+	}
+	return ID, jti, nil
+}
+
 func GetSingleUser(ID primitive.ObjectID) (*models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	var user models.User
@@ -57,7 +133,7 @@ func GetSingleUser(ID primitive.ObjectID) (*models.User, error) {
 	// 	return nil, err
 	// }
 	// fmt.Println(objID, "hd6hdh")
-	err := userCollection.FindOne(ctx, bson.M{"_id": ID}).Decode(&user)
+	err := userCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": ID})).Decode(&user)
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +202,8 @@ func Middleware() gin.HandlerFunc {
 		}
 		claims, ok := token.Claims.(jwt.MapClaims)
 
-		if !ok || !token.Valid {
+		// link tokens are only good for the flow they were issued for
+		if _, isLink := claims["purpose"]; !ok || !token.Valid || isLink {
 			helpers.CreateResponse(c, helpers.Response{
 				Message:    "invalid jwt",
 				StatusCode: http.StatusBadRequest,
@@ -145,6 +222,18 @@ func Middleware() gin.HandlerFunc {
 			})
 			return
 		}
+		// every token belongs to a session, otherwise signing out everywhere could not revoke it
+		sid, _ := claims["sid"].(string)
+		if err := touchSession(sid, objID, claims); err != nil {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusUnauthorized,
+				Data:       nil,
+			})
+			return
+		}
+		c.Set("session_id", sid)
+
 		user, err := GetUser(objID)
 		if err != nil {
 			helpers.CreateResponse(c, helpers.Response{
@@ -154,8 +243,111 @@ func Middleware() gin.HandlerFunc {
 			})
 			return
 		}
+		if user.IsErased() {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    models.ErrErased.Error(),
+				StatusCode: http.StatusUnauthorized,
+				Data:       nil,
+			})
+			return
+		}
+		if user.IsSuspended() {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    models.ErrSuspended.Error(),
+				StatusCode: http.StatusForbidden,
+				Data:       nil,
+			})
+			return
+		}
+
+		if imp, ok := claims["imp"].(string); ok {
+			impersonator, err := getImpersonator(imp)
+			if err != nil {
+				helpers.CreateResponse(c, helpers.Response{
+					Message:    err.Error(),
+					StatusCode: http.StatusUnauthorized,
+					Data:       nil,
+				})
+				return
+			}
+			user.ImpersonatedBy = impersonator
+		}
+
 		c.Set("claims", claims)
 		c.Set("user", user)
 		c.Next()
+
+		// every request made while impersonating is kept on record
+		if user.IsImpersonated() {
+			entry := models.AuditEntry{
+				ActorID:        user.ImpersonatedBy.Id,
+				ImpersonatedID: user.Id,
+				Action:         models.AuditImpersonationRequest,
+				TargetType:     "user",
+				TargetID:       user.Id.Hex(),
+				Method:         c.Request.Method,
+				Path:           c.Request.URL.Path,
+				StatusCode:     c.Writer.Status(),
+				IP:             c.ClientIP(),
+				RequestID:      c.GetString(models.RequestIDKey),
+				CreatedAt:      time.Now(),
+			}
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				audit.Record(ctx, entry)
+			}()
+		}
+	}
+}
+
+// touchSession checks the session a token belongs to is still signed in; impersonation tokens belong to a session of the super-admin
+func touchSession(sid string, userID primitive.ObjectID, claims jwt.MapClaims) error {
+	if sid == "" {
+		return ErrNoSession
+	}
+	sessionID, err := primitive.ObjectIDFromHex(sid)
+	if err != nil {
+		return ErrNoSession
+	}
+	owner := userID
+	if imp, ok := claims["imp"].(string); ok {
+		owner, err = primitive.ObjectIDFromHex(imp)
+		if err != nil {
+			return fmt.Errorf("invalid impersonation token")
+		}
+	}
+	return sessions.Touch(sessionID, owner)
+}
+
+// getImpersonator loads the super-admin behind an impersonation token and checks they still are one
+func getImpersonator(ID string) (*models.User, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid impersonation token")
+	}
+	impersonator, err := GetUser(objID)
+	if err != nil {
+		return nil, err
+	}
+	if impersonator.RoleName != models.SuperAdminRole {
+		return nil, fmt.Errorf("impersonation is no longer allowed")
+	}
+	return &impersonator, nil
+}
+
+// NotImpersonating blocks destructive actions such as deleting the account or changing credentials while impersonating
+func NotImpersonating() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := models.GetUserFromContext(c)
+		if err == nil && user.IsImpersonated() {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    models.ErrImpersonating.Error(),
+				StatusCode: http.StatusForbidden,
+				Data:       nil,
+			})
+			return
+		}
+		c.Next()
 	}
 }
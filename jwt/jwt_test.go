@@ -4,20 +4,33 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"testing"
+	"time"
 )
 
 func TestGenerateJWT(t *testing.T) {
 	// Mock providerID
 	providerID := primitive.NewObjectID()
 
-	// Call GenerateJWT function
-	tokenString, err := GenerateJWT(providerID)
+	// Call GenerateSessionJWT function
+	tokenString, err := GenerateSessionJWT(providerID, primitive.NewObjectID())
 
 	// Assert no error
 	assert.NoError(t, err)
 
 	// Assert that the token string is not empty
 	assert.NotEmpty(t, tokenString)
+
+	// a token without a session could not be signed out
+	_, err = GenerateSessionJWT(providerID, primitive.NilObjectID)
+	assert.Equal(t, ErrNoSession, err)
+	_, err = GenerateImpersonationJWT(providerID, primitive.NewObjectID(), primitive.NilObjectID)
+	assert.Equal(t, ErrNoSession, err)
+}
+
+func TestTouchSession_NoSession(t *testing.T) {
+	// tokens issued before every token carried a session are turned away
+	assert.Equal(t, ErrNoSession, touchSession("", primitive.NewObjectID(), nil))
+	assert.Equal(t, ErrNoSession, touchSession("not-an-id", primitive.NewObjectID(), nil))
 }
 
 func TestGetUser(t *testing.T) {
@@ -28,3 +41,25 @@ func TestGetUser(t *testing.T) {
 
 	assert.NotNil(t,user)
 }
+
+func TestLinkToken(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	tokenString, jti, err := GenerateLinkToken(id, "magic-link", time.Minute)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, jti)
+
+	parsedID, parsedJti, err := ParseLinkToken(tokenString, "magic-link")
+	assert.NoError(t, err)
+	assert.Equal(t, id, parsedID)
+	assert.Equal(t, jti, parsedJti)
+
+	// a token issued for one flow must not work for another
+	_, _, err = ParseLinkToken(tokenString, "email-change")
+	assert.Error(t, err)
+
+	expired, _, err := GenerateLinkToken(id, "magic-link", -time.Minute)
+	assert.NoError(t, err)
+	_, _, err = ParseLinkToken(expired, "magic-link")
+	assert.Error(t, err)
+}
@@ -4,8 +4,9 @@ import (
 	// "context"
 	"flag"
 	"log"
+	"os"
+	"strings"
 	"time"
-	// "os"
 
 	// apitoolkit "github.com/apitoolkit/apitoolkit-go"
 	"github.com/gin-gonic/gin"
@@ -14,6 +15,13 @@ import (
 	// "github.com/joho/godotenv"
 	"go.uber.org/ratelimit"
 	"league/db"
+	"league/e-teams"
+	"league/fixtures"
+	"league/middleware"
+	"league/notifications"
+	"league/outbox"
+	"league/users"
+	"league/webhooks"
 )
 
 var (
@@ -30,6 +38,18 @@ func leakBucket() gin.HandlerFunc {
 	}
 }
 
+// trustedProxies reads TRUSTED_PROXIES, a comma separated list of addresses or CIDR ranges;
+// without it no proxy is trusted and the client IP is the address the request came from
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 func main() {
 	// if err := godotenv.Load(); err != nil {
 	// 	log.Fatalf("Failed to load the env vars: %v", err)
@@ -44,9 +64,14 @@ func main() {
 	flag.Parse()
 
 	app := gin.New()
+	// X-Forwarded-For is only believed from trusted proxies, otherwise anyone could pick the IP the login lockout counts
+	if err := app.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	// app.Use(apitoolkitClient.GinMiddleware)
 	app.Use(cors.Default())
 	app.Use(leakBucket())
+	app.Use(middleware.RequestID())
 	router := app.Group("/api/v1")
 
 	AddRoutes(router)
@@ -54,6 +79,15 @@ func main() {
 	// connect db, but remove to run e2e tests
 	db.ConnectDB()
 
+	// background jobs
+	users.StartErasureWorker()
+	outbox.StartWorkers()
+	notifications.StartScheduler()
+	webhooks.StartWorkers()
+	users.StartPurgeWorker()
+	teams.StartPurgeWorker()
+	fixtures.StartPurgeWorker()
+
 	app.Run(":8000")
 
 	log.Print("Server listening on http://localhost:8000/")
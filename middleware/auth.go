@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"league/apikeys"
+	"league/jwt"
+)
+
+// Authenticate accepts either an API key or a bearer jwt
+func Authenticate() gin.HandlerFunc {
+	keyAuth := apikeys.Middleware()
+	jwtAuth := jwt.Middleware()
+	return func(c *gin.Context) {
+		if c.Request.Header.Get(apikeys.Header) != "" {
+			keyAuth(c)
+			return
+		}
+		jwtAuth(c)
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"league/helpers"
+	"league/models"
+	"league/roles"
+)
+
+// RequirePermission only lets the request through when the user's role grants the permission
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := models.GetUserFromContext(c)
+		if err != nil {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusInternalServerError,
+				Data:       nil,
+			})
+			return
+		}
+
+		allowed, err := roles.HasPermission(user.RoleName, permission)
+		if err != nil {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusInternalServerError,
+				Data:       nil,
+			})
+			return
+		}
+
+		// requests made with an api key are further limited to the key's scopes
+		if value, exists := c.Get("scopes"); exists && allowed {
+			scopes, _ := value.([]models.Permission)
+			allowed = models.HasPermission(scopes, permission)
+		}
+
+		if !allowed {
+			helpers.CreateResponse(c, helpers.Response{
+				Message:    "You don't have the required permission for this resource",
+				StatusCode: http.StatusUnauthorized,
+				Data:       nil,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"league/models"
+)
+
+// serve runs the middleware for a user of the role, with the api key scopes when given
+func serve(permission models.Permission, role models.Role, scopes []models.Permission) int {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		c.Set("user", models.User{RoleName: role})
+		if scopes != nil {
+			c.Set("scopes", scopes)
+		}
+		c.Next()
+	}, RequirePermission(permission), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	return recorder.Code
+}
+
+func TestRequirePermission(t *testing.T) {
+	assert.Equal(t, http.StatusOK, serve(models.FixturesWrite, models.AdminRole, nil))
+	assert.Equal(t, http.StatusUnauthorized, serve(models.RolesWrite, models.AdminRole, nil))
+	assert.Equal(t, http.StatusUnauthorized, serve(models.FixturesWrite, models.UserRole, nil))
+
+	// the super-admin's "*" grants everything
+	assert.Equal(t, http.StatusOK, serve(models.RolesWrite, models.SuperAdminRole, nil))
+}
+
+func TestRequirePermission_Scopes(t *testing.T) {
+	// an api key narrows the role's permissions to its scopes
+	assert.Equal(t, http.StatusOK, serve(models.FixturesWrite, models.AdminRole, []models.Permission{"fixtures:*"}))
+	assert.Equal(t, http.StatusUnauthorized, serve(models.TeamsWrite, models.AdminRole, []models.Permission{"fixtures:*"}))
+	assert.Equal(t, http.StatusUnauthorized, serve(models.FixturesWrite, models.AdminRole, []models.Permission{}))
+
+	// but never widens them
+	assert.Equal(t, http.StatusUnauthorized, serve(models.RolesWrite, models.AdminRole, []models.Permission{models.AllPermissions}))
+}
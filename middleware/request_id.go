@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+
+	"league/models"
+)
+
+// RequestIDHeader carries the request ID; a well formed one sent by a proxy is kept so logs line up
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags every request with an ID that is echoed back and stored with audit entries
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ID := c.Request.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(ID) {
+			ID = newRequestID()
+		}
+		c.Set(models.RequestIDKey, ID)
+		c.Writer.Header().Set(RequestIDHeader, ID)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	ID := make([]byte, 16)
+	if _, err := rand.Read(ID); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(ID)
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name       string             `bson:"name" validate:"required" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	KeyHash    string             `bson:"key_hash" json:"-"`
+	Scopes     []Permission       `bson:"scopes" json:"scopes"`
+	DailyQuota int64              `bson:"daily_quota" json:"daily_quota"`
+	ExpiresAt  time.Time          `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	RevokedAt  time.Time          `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+func (k *APIKey) IsActive() bool {
+	if !k.RevokedAt.IsZero() {
+		return false
+	}
+	return k.ExpiresAt.IsZero() || k.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+
+	AuditFixtureCreate  = "fixture.create"
+	AuditFixtureUpdate  = "fixture.update"
+	AuditFixtureStats   = "fixture.stats"
+	AuditFixtureDelete  = "fixture.delete"
+	AuditFixtureRestore = "fixture.restore"
+	// undelete takes a document back out of the trash
+	AuditFixtureUndelete = "fixture.undelete"
+
+	AuditTeamCreate   = "team.create"
+	AuditTeamUpdate   = "team.update"
+	AuditTeamDelete   = "team.delete"
+	AuditTeamUndelete = "team.undelete"
+	AuditPlayerUpdate = "player.update"
+
+	AuditUserRole          = "user.role"
+	AuditUserClubs         = "user.clubs"
+	AuditUserSuspend       = "user.suspend"
+	AuditUserUnsuspend     = "user.unsuspend"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditUserDelete        = "user.delete"
+	AuditUserUndelete      = "user.undelete"
+
+	AuditRoleCreate = "role.create"
+	AuditRoleUpdate = "role.update"
+	AuditRoleDelete = "role.delete"
+
+	AuditInviteCreate = "invite.create"
+	AuditInviteRevoke = "invite.revoke"
+
+	AuditIntegrityRepair = "integrity.repair"
+)
+
+// RequestIDKey is where the request ID middleware keeps the ID on the gin context
+const RequestIDKey = "request_id"
+
+type AuditEntry struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	// ActorID is who performed the action; for impersonated requests that is the super-admin
+	ActorID        primitive.ObjectID `bson:"actor_id" json:"actor_id"`
+	ImpersonatedID primitive.ObjectID `bson:"impersonated_id,omitempty" json:"impersonated_id,omitempty"`
+	Action         string             `bson:"action" json:"action"`
+	TargetType     string             `bson:"target_type,omitempty" json:"target_type,omitempty"`
+	TargetID       string             `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	Changes        []AuditChange      `bson:"changes,omitempty" json:"changes,omitempty"`
+	Method         string             `bson:"method,omitempty" json:"method,omitempty"`
+	Path           string             `bson:"path,omitempty" json:"path,omitempty"`
+	StatusCode     int                `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	IP             string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	RequestID      string             `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// AuditChange is one field that differs between the document before and after a change,
+// nested fields use dotted paths like home.goals
+type AuditChange struct {
+	Field  string      `bson:"field" json:"field"`
+	Before interface{} `bson:"before,omitempty" json:"before,omitempty"`
+	After  interface{} `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+// AuditActor is who made a change and where from; handlers build it and services pass it on with their events
+type AuditActor struct {
+	UserID         primitive.ObjectID
+	ImpersonatedID primitive.ObjectID
+	IP             string
+	RequestID      string
+}
+
+// IsZero reports whether the change was made without an admin behind it, e.g. a user editing their own account
+func (a AuditActor) IsZero() bool {
+	return a.UserID.IsZero()
+}
+
+// AuditActorFromContext returns the actor of the request; when impersonating, the super-admin is the actor
+func AuditActorFromContext(ctx *gin.Context) AuditActor {
+	actor := AuditActor{IP: ctx.ClientIP(), RequestID: ctx.GetString(RequestIDKey)}
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		return actor
+	}
+	actor.UserID = user.Id
+	if user.IsImpersonated() {
+		actor.UserID = user.ImpersonatedBy.Id
+		actor.ImpersonatedID = user.Id
+	}
+	return actor
+}
@@ -40,8 +40,17 @@ type Fixture struct {
 	UniqueLink    string             `bson:"unique_link" validate:"required" json:"unique_link"`
 	Stadium       string             `bson:"stadium" json:"stadium"`
 	Referee       string             `bson:"referee" json:"referee"`
-	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+	// set when the date changes so followers can be told about it
+	RescheduledAt time.Time `bson:"rescheduled_at,omitempty" json:"rescheduled_at,omitempty"`
+	PreviousDate  time.Time `bson:"previous_date,omitempty" json:"previous_date,omitempty"`
+	// set when a lineup is published through the stats endpoint
+	LineupPublishedAt time.Time `bson:"lineup_published_at,omitempty" json:"lineup_published_at,omitempty"`
+	CreatedAt         time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time `bson:"updated_at" json:"updated_at"`
+	// Version goes up with every update and is served as the ETag
+	Version int64 `bson:"version" json:"version"`
+	// DeletedAt puts the fixture in the trash until it is restored or purged
+	DeletedAt time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
 }
 
 type Player struct {
@@ -53,6 +62,8 @@ type Player struct {
 	Status    PlayerStatus       `bson:"status" json:"status"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	// Version goes up with every update and is served as the ETag
+	Version int64 `bson:"version" json:"version"`
 }
 
 type Details struct {
@@ -74,3 +85,30 @@ type Details struct {
 	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt      time.Time `bson:"updated_at" json:"updated_at"`
 }
+
+// RevisionChange says what produced a fixture revision
+type RevisionChange string
+
+const (
+	// RevisionBaseline is the state a fixture had before its history was first recorded
+	RevisionBaseline RevisionChange = "baseline"
+	RevisionCreate   RevisionChange = "create"
+	RevisionUpdate   RevisionChange = "update"
+	RevisionStats    RevisionChange = "stats"
+	RevisionRestore  RevisionChange = "restore"
+)
+
+// FixtureRevision is a snapshot of a fixture after one change, revisions count up from 1 per fixture
+type FixtureRevision struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	FixtureID primitive.ObjectID `bson:"fixture_id" json:"fixture_id"`
+	// Revision is the version of the fixture it holds plus one, versions changed outside of edits leave gaps
+	Revision int            `bson:"revision" json:"revision"`
+	Change   RevisionChange `bson:"change" json:"change"`
+	Snapshot Fixture        `bson:"snapshot" json:"snapshot"`
+	// EditorID is who made the change; for impersonated requests ImpersonatedID is the user acted as
+	EditorID       primitive.ObjectID `bson:"editor_id,omitempty" json:"editor_id,omitempty"`
+	ImpersonatedID primitive.ObjectID `bson:"impersonated_id,omitempty" json:"impersonated_id,omitempty"`
+	RestoredFrom   int                `bson:"restored_from,omitempty" json:"restored_from,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// OnDelete says what happens to the documents that reference one that is deleted
+type OnDelete string
+
+const (
+	// Restrict refuses the delete while anything still references the document
+	Restrict OnDelete = "restrict"
+	// Cascade deletes the referencing documents too, trashing them where the collection has a trash
+	Cascade OnDelete = "cascade"
+	// Nullify removes the reference and keeps the referencing document
+	Nullify OnDelete = "nullify"
+)
+
+func (o OnDelete) IsValid() bool {
+	switch o {
+	case Restrict, Cascade, Nullify:
+		return true
+	}
+	return false
+}
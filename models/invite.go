@@ -0,0 +1,26 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type InviteStatus string
+
+const (
+	InvitePending  InviteStatus = "pending"
+	InviteAccepted InviteStatus = "accepted"
+	InviteRevoked  InviteStatus = "revoked"
+)
+
+type Invite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Email     string             `bson:"email" validate:"required" json:"email"`
+	RoleName  Role               `bson:"role" validate:"required" json:"role"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	Status    InviteStatus       `bson:"status" json:"status"`
+	InvitedBy primitive.ObjectID `bson:"invited_by" json:"invited_by"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
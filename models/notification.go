@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type NotificationEvent string
+
+const (
+	KickoffReminder    NotificationEvent = "kickoff_reminder"
+	FinalScore         NotificationEvent = "final_score"
+	LineupPublished    NotificationEvent = "lineup_published"
+	FixtureRescheduled NotificationEvent = "fixture_rescheduled"
+)
+
+// NotificationEvents lists every event a user can subscribe to
+var NotificationEvents []NotificationEvent = []NotificationEvent{
+	KickoffReminder,
+	FinalScore,
+	LineupPublished,
+	FixtureRescheduled,
+}
+
+type NotificationChannel string
+
+const (
+	EmailChannel NotificationChannel = "email"
+)
+
+// NotificationPreferences says what a user follows and how they want to hear about it
+type NotificationPreferences struct {
+	ID           primitive.ObjectID    `bson:"_id,omitempty" json:"_id"`
+	UserID       primitive.ObjectID    `bson:"user_id" json:"user_id"`
+	Teams        []primitive.ObjectID  `bson:"teams" json:"teams"`
+	Competitions []primitive.ObjectID  `bson:"competitions" json:"competitions"`
+	Channels     []NotificationChannel `bson:"channels" json:"channels"`
+	Events       []NotificationEvent   `bson:"events" json:"events"`
+	// ReminderHours is how long before kickoff the reminder goes out
+	ReminderHours int `bson:"reminder_hours" json:"reminder_hours"`
+	// Digest collects the day's notifications into one email instead of sending them as they happen
+	Digest       bool      `bson:"digest" json:"digest"`
+	LastDigestAt time.Time `bson:"last_digest_at,omitempty" json:"last_digest_at,omitempty"`
+	// UnsubscribeToken authenticates the one-click unsubscribe link in every email
+	UnsubscribeToken string    `bson:"unsubscribe_token" json:"-"`
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+func (p *NotificationPreferences) Wants(event NotificationEvent) bool {
+	for _, e := range p.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type NotificationStatus string
+
+const (
+	NotificationPending NotificationStatus = "pending"
+	NotificationSent    NotificationStatus = "sent"
+	NotificationSkipped NotificationStatus = "skipped"
+)
+
+// Notification is one event for one user; DedupeKey stops the scheduler from creating it twice
+type Notification struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID          primitive.ObjectID `bson:"user_id" json:"user_id"`
+	FixtureID       primitive.ObjectID `bson:"fixture_id" json:"fixture_id"`
+	Event           NotificationEvent  `bson:"event" json:"event"`
+	DedupeKey       string             `bson:"dedupe_key" json:"-"`
+	HomeTeam        string             `bson:"home_team" json:"home_team"`
+	AwayTeam        string             `bson:"away_team" json:"away_team"`
+	HomeGoals       int                `bson:"home_goals" json:"home_goals"`
+	AwayGoals       int                `bson:"away_goals" json:"away_goals"`
+	Kickoff         time.Time          `bson:"kickoff" json:"kickoff"`
+	PreviousKickoff time.Time          `bson:"previous_kickoff,omitempty" json:"previous_kickoff,omitempty"`
+	Status          NotificationStatus `bson:"status" json:"status"`
+	SentAt          time.Time          `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+}
+
+func IsValidNotificationEvent(event NotificationEvent) bool {
+	for _, e := range NotificationEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
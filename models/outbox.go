@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OutboxStatus string
+
+const (
+	// OutboxQueued messages wait for a worker, including ones waiting to be retried
+	OutboxQueued  OutboxStatus = "queued"
+	OutboxSending OutboxStatus = "sending"
+	OutboxSent    OutboxStatus = "sent"
+	// OutboxFailed is the dead-letter state: delivery gave up and only a manual retry sends it again
+	OutboxFailed OutboxStatus = "failed"
+)
+
+// OutboxMessage is an email waiting in, or delivered from, the outbox
+type OutboxMessage struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	From          string             `bson:"from" json:"from"`
+	To            []string           `bson:"to" json:"to"`
+	Subject       string             `bson:"subject" json:"subject"`
+	HTML          string             `bson:"html" json:"html,omitempty"`
+	Text          string             `bson:"text,omitempty" json:"text,omitempty"`
+	Headers       map[string]string  `bson:"headers,omitempty" json:"headers,omitempty"`
+	Status        OutboxStatus       `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	LastError     string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	// LockedUntil lets another worker pick the message up if the one sending it dies
+	LockedUntil time.Time `bson:"locked_until,omitempty" json:"-"`
+	SentAt      time.Time `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+func IsValidOutboxStatus(status OutboxStatus) bool {
+	switch status {
+	case OutboxQueued, OutboxSending, OutboxSent, OutboxFailed:
+		return true
+	}
+	return false
+}
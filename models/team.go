@@ -16,6 +16,10 @@ type Team struct {
 	CreatedBy   primitive.ObjectID `bson:"created_by" json:"created_by"`
 	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	// Version goes up with every update and is served as the ETag
+	Version int64 `bson:"version" json:"version"`
+	// DeletedAt puts the team in the trash until it is restored or purged
+	DeletedAt time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
 }
 
 // type Trophy struct {
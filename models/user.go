@@ -14,25 +14,175 @@ const (
 	SuperAdminRole Role = "super-admin"
 	AdminRole      Role = "admin"
 	UserRole       Role = "user"
+	ClubAdminRole  Role = "club-admin"
 )
 
+type Permission string
+
+const (
+	AllPermissions Permission = "*"
+	FixturesWrite  Permission = "fixtures:write"
+	FixturesDelete Permission = "fixtures:delete"
+	TeamsWrite     Permission = "teams:write"
+	TeamsDelete    Permission = "teams:delete"
+	PlayersWrite   Permission = "players:write"
+	FixturesStats  Permission = "fixtures:stats"
+	UsersRead      Permission = "users:read"
+	UsersWrite     Permission = "users:write"
+	RolesWrite     Permission = "roles:write"
+	InvitesWrite   Permission = "invites:write"
+	EmailsRead     Permission = "emails:read"
+	EmailsWrite    Permission = "emails:write"
+	WebhooksWrite  Permission = "webhooks:write"
+	AuditRead      Permission = "audit:read"
+	IntegrityRead  Permission = "integrity:read"
+	IntegrityWrite Permission = "integrity:write"
+)
+
+// Permissions lists every permission that can be granted to a role
+var Permissions []Permission = []Permission{
+	FixturesWrite,
+	FixturesDelete,
+	TeamsWrite,
+	TeamsDelete,
+	PlayersWrite,
+	FixturesStats,
+	UsersRead,
+	UsersWrite,
+	RolesWrite,
+	InvitesWrite,
+	EmailsRead,
+	EmailsWrite,
+	WebhooksWrite,
+	AuditRead,
+	IntegrityRead,
+	IntegrityWrite,
+}
+
+type RoleDefinition struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	Name        Role               `bson:"name" validate:"required" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Permissions []Permission       `bson:"permissions" json:"permissions"`
+	BuiltIn     bool               `bson:"built_in" json:"built_in"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Can reports whether the role grants the permission, honouring "*" and "resource:*" wildcards
+func (r *RoleDefinition) Can(permission Permission) bool {
+	return HasPermission(r.Permissions, permission)
+}
+
+func HasPermission(granted []Permission, permission Permission) bool {
+	resource := strings.SplitN(string(permission), ":", 2)[0]
+	for _, p := range granted {
+		if p == AllPermissions || p == permission || p == Permission(resource+":*") {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrPrivilegedPermission = errors.New("only super-admins can grant full access, role management or invites")
+
+// IsPrivileged reports whether the permissions include role management or invites, directly or through a wildcard;
+// whoever holds either can grant themselves, or a new account, anything
+func IsPrivileged(permissions []Permission) bool {
+	return HasPermission(permissions, RolesWrite) || HasPermission(permissions, InvitesWrite)
+}
+
+func IsValidPermission(permission Permission) bool {
+	if permission == AllPermissions {
+		return true
+	}
+	for _, p := range Permissions {
+		if p == permission || Permission(strings.SplitN(string(p), ":", 2)[0]+":*") == permission {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
-	Id                primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
-	FirstName         string             `bson:"first_name,omitempty" validate:"required" json:"first_name"`
-	LastName          string             `bson:"last_name,omitempty" validate:"required" json:"last_name"`
-	Email             string             `bson:"email" validate:"required" json:"email"`
-	RoleName          Role               `bson:"role" validate:"required" json:"role"`
-	VerificationToken string             `bson:"verification_token" json:"verification_token"`
-	ExpiresAt         time.Time          `bson:"expires_at" json:"expires_at"`
-	Password          string             `bson:"password" json:"-"`
-	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
+	Id        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	FirstName string             `bson:"first_name,omitempty" validate:"required" json:"first_name"`
+	LastName  string             `bson:"last_name,omitempty" validate:"required" json:"last_name"`
+	Email     string             `bson:"email" validate:"required" json:"email"`
+	// Locale picks the language of emails, e.g. "fr" or "fr-CA"; empty means the default
+	Locale                string               `bson:"locale,omitempty" json:"locale,omitempty"`
+	RoleName              Role                 `bson:"role" validate:"required" json:"role"`
+	VerificationToken     string               `bson:"verification_token" json:"verification_token"`
+	ExpiresAt             time.Time            `bson:"expires_at" json:"expires_at"`
+	Password              string               `bson:"password" json:"-"`
+	PasswordHistory       []string             `bson:"password_history,omitempty" json:"-"`
+	Clubs                 []primitive.ObjectID `bson:"clubs,omitempty" json:"clubs,omitempty"`
+	Identities            []Identity           `bson:"identities,omitempty" json:"identities,omitempty"`
+	SuspendedAt           time.Time            `bson:"suspended_at,omitempty" json:"suspended_at,omitempty"`
+	SuspendedReason       string               `bson:"suspended_reason,omitempty" json:"suspended_reason,omitempty"`
+	PasswordResetRequired bool                 `bson:"password_reset_required,omitempty" json:"password_reset_required,omitempty"`
+	ErasureScheduledFor   time.Time            `bson:"erasure_scheduled_for,omitempty" json:"erasure_scheduled_for,omitempty"`
+	ErasedAt              time.Time            `bson:"erased_at,omitempty" json:"erased_at,omitempty"`
+	DeletedAt             time.Time            `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	CreatedAt             time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt             time.Time            `bson:"updated_at" json:"updated_at"`
+	// ImpersonatedBy is set on the request's user while a super-admin is impersonating them
+	ImpersonatedBy *User `bson:"-" json:"impersonated_by,omitempty"`
+}
+
+// Identity links an account to a user at an external OpenID Connect provider
+type Identity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"-"`
+	LinkedAt time.Time `bson:"linked_at" json:"linked_at"`
 }
 
 func (u *User) SetEmail() {
 	u.Email = strings.ToLower(u.Email)
 }
 
+var ErrNotClubAdmin = errors.New("you can only manage your own club")
+
+// IsClubScoped reports whether the user's rights are limited to the clubs they administer
+func (u *User) IsClubScoped() bool {
+	return u.RoleName == ClubAdminRole
+}
+
+// ManagesTeam reports whether the user may manage the team; league admins manage every team
+func (u *User) ManagesTeam(teamID primitive.ObjectID) bool {
+	if !u.IsClubScoped() {
+		return true
+	}
+	for _, id := range u.Clubs {
+		if id == teamID {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrSuspended = errors.New("your account has been suspended")
+var ErrPasswordResetRequired = errors.New("you need to reset your password before signing in")
+
+func (u *User) IsSuspended() bool {
+	return !u.SuspendedAt.IsZero()
+}
+
+var ErrErased = errors.New("this account has been deleted")
+
+// IsErased reports whether the account was anonymised after an erasure request
+func (u *User) IsErased() bool {
+	return !u.ErasedAt.IsZero()
+}
+
+var ErrImpersonating = errors.New("this action is not allowed while impersonating a user")
+
+// IsImpersonated reports whether the request is being made by a super-admin on the user's behalf
+func (u *User) IsImpersonated() bool {
+	return u.ImpersonatedBy != nil
+}
+
+// GetUserFromContext returns the user the request acts as; when impersonating, ImpersonatedBy holds the super-admin
 func GetUserFromContext(ctx *gin.Context) (*User, error) {
 	value, exists := ctx.Get("user")
 	if !exists {
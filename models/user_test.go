@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasPermission(t *testing.T) {
+	// exact grants only match themselves
+	assert.True(t, HasPermission([]Permission{FixturesWrite}, FixturesWrite))
+	assert.False(t, HasPermission([]Permission{FixturesWrite}, FixturesDelete))
+	assert.False(t, HasPermission(nil, FixturesWrite))
+
+	// "resource:*" grants every action on the resource and nothing else
+	assert.True(t, HasPermission([]Permission{"fixtures:*"}, FixturesWrite))
+	assert.True(t, HasPermission([]Permission{"fixtures:*"}, FixturesDelete))
+	assert.False(t, HasPermission([]Permission{"fixtures:*"}, TeamsWrite))
+
+	// "*" grants everything
+	assert.True(t, HasPermission([]Permission{AllPermissions}, RolesWrite))
+}
+
+func TestIsPrivileged(t *testing.T) {
+	assert.True(t, IsPrivileged([]Permission{AllPermissions}))
+	assert.True(t, IsPrivileged([]Permission{RolesWrite}))
+	assert.True(t, IsPrivileged([]Permission{"roles:*"}))
+	// invites can create a super-admin, so they are as privileged as role management
+	assert.True(t, IsPrivileged([]Permission{InvitesWrite}))
+	assert.True(t, IsPrivileged([]Permission{"invites:*"}))
+
+	assert.False(t, IsPrivileged([]Permission{FixturesWrite, UsersWrite, "teams:*"}))
+}
+
+func TestIsValidPermission(t *testing.T) {
+	assert.True(t, IsValidPermission(AllPermissions))
+	assert.True(t, IsValidPermission(FixturesWrite))
+	assert.True(t, IsValidPermission("fixtures:*"))
+
+	assert.False(t, IsValidPermission("fixtures:read"))
+	assert.False(t, IsValidPermission("stadiums:*"))
+}
@@ -0,0 +1,9 @@
+package models
+
+import "errors"
+
+// AnyVersion is what If-Match: * asks for, the update applies to whatever version is current
+const AnyVersion int64 = -1
+
+// ErrVersionMismatch is returned when a document changed since the client read the version it sent in If-Match
+var ErrVersionMismatch = errors.New("this has been changed since you loaded it, fetch it again and retry")
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebhookEvent string
+
+const (
+	AllWebhookEvents          WebhookEvent = "*"
+	WebhookFixtureCreated     WebhookEvent = "fixture.created"
+	WebhookFixtureRescheduled WebhookEvent = "fixture.rescheduled"
+	WebhookFixtureStatus      WebhookEvent = "fixture.status_changed"
+	WebhookFixtureScore       WebhookEvent = "fixture.score_changed"
+	WebhookTeamCreated        WebhookEvent = "team.created"
+	WebhookTeamUpdated        WebhookEvent = "team.updated"
+	WebhookTeamDeleted        WebhookEvent = "team.deleted"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents []WebhookEvent = []WebhookEvent{
+	WebhookFixtureCreated,
+	WebhookFixtureRescheduled,
+	WebhookFixtureStatus,
+	WebhookFixtureScore,
+	WebhookTeamCreated,
+	WebhookTeamUpdated,
+	WebhookTeamDeleted,
+}
+
+func IsValidWebhookEvent(event WebhookEvent) bool {
+	if event == AllWebhookEvents {
+		return true
+	}
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is a subscription of a downstream system to some of our events
+type Webhook struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	URL    string             `bson:"url" json:"url"`
+	Events []WebhookEvent     `bson:"events" json:"events"`
+	// Secret signs every payload; it is only shown when the webhook is created
+	Secret    string             `bson:"secret" json:"-"`
+	Active    bool               `bson:"active" json:"active"`
+	CreatedBy primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+func (w *Webhook) Wants(event WebhookEvent) bool {
+	for _, e := range w.Events {
+		if e == event || e == AllWebhookEvents {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent to one webhook, with a log of every attempt
+type WebhookDelivery struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	WebhookID primitive.ObjectID `bson:"webhook_id" json:"webhook_id"`
+	Event     WebhookEvent       `bson:"event" json:"event"`
+	// Payload is the exact JSON body that is signed and posted
+	Payload       string             `bson:"payload" json:"payload"`
+	Status        DeliveryStatus     `bson:"status" json:"status"`
+	Attempts      []WebhookAttempt   `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil   time.Time          `bson:"locked_until,omitempty" json:"-"`
+	ReplayOf      primitive.ObjectID `bson:"replay_of,omitempty" json:"replay_of,omitempty"`
+	DeliveredAt   time.Time          `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+type WebhookAttempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Response   string    `bson:"response,omitempty" json:"response,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMS int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+func (a WebhookAttempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
@@ -0,0 +1,222 @@
+package notifications
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"league/helpers"
+	"league/models"
+)
+
+func getNotificationsHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	notifications, total, page, perPage, err := getNotifications(user.Id, ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched notifications",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     notifications,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func getPreferencesHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	prefs, err := getPreferences(user.Id)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched notification preferences",
+		StatusCode: http.StatusOK,
+		Data:       prefs,
+	})
+}
+
+func updatePreferencesHandler(ctx *gin.Context) {
+	var req PreferencesRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	prefs, err := savePreferences(user.Id, req)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully updated notification preferences",
+		StatusCode: http.StatusOK,
+		Data:       prefs,
+	})
+}
+
+// followHandler follows a team or a competition, kind being "teams" or "competitions"
+func followHandler(kind string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := models.GetUserFromContext(ctx)
+		if err != nil {
+			helpers.CreateResponse(ctx, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusInternalServerError,
+				Data:       nil,
+			})
+			return
+		}
+
+		prefs, err := follow(user.Id, kind, ctx.Param("id"))
+		if err != nil {
+			helpers.CreateResponse(ctx, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusBadRequest,
+				Data:       nil,
+			})
+			return
+		}
+
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    "successfully followed",
+			StatusCode: http.StatusOK,
+			Data:       prefs,
+		})
+	}
+}
+
+func unfollowHandler(kind string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := models.GetUserFromContext(ctx)
+		if err != nil {
+			helpers.CreateResponse(ctx, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusInternalServerError,
+				Data:       nil,
+			})
+			return
+		}
+
+		prefs, err := unfollow(user.Id, kind, ctx.Param("id"))
+		if err != nil {
+			helpers.CreateResponse(ctx, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusBadRequest,
+				Data:       nil,
+			})
+			return
+		}
+
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    "successfully unfollowed",
+			StatusCode: http.StatusOK,
+			Data:       prefs,
+		})
+	}
+}
+
+// confirmPage posts back to the same address, query string included
+var confirmPage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+<p>Stop receiving {{if .}}these{{else}}all{{end}} match notification emails?</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>
+</body>
+</html>
+`))
+
+// confirmUnsubscribeHandler shows a button that unsubscribes, opening the link alone changes nothing
+func confirmUnsubscribeHandler(ctx *gin.Context) {
+	var page bytes.Buffer
+	if err := confirmPage.Execute(&page, ctx.Query("event")); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// unsubscribeHandler takes ?token= from the email and an optional ?event= to only drop that event;
+// mail clients following RFC 8058 post List-Unsubscribe=One-Click to the same address
+func unsubscribeHandler(ctx *gin.Context) {
+	err := unsubscribe(ctx.Query("token"), ctx.Query("event"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrInvalidUnsubscribeLink) {
+			status = http.StatusNotFound
+		}
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: status,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully unsubscribed",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
@@ -0,0 +1,16 @@
+package notifications
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+)
+
+type PreferencesRequest struct {
+	Teams         []primitive.ObjectID         `json:"teams"`
+	Competitions  []primitive.ObjectID         `json:"competitions"`
+	Channels      []models.NotificationChannel `json:"channels" binding:"dive,oneof=email"`
+	Events        []models.NotificationEvent   `json:"events"`
+	ReminderHours int                          `json:"reminder_hours" binding:"omitempty,min=1,max=48"`
+	Digest        bool                         `json:"digest"`
+}
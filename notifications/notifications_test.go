@@ -0,0 +1,40 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+)
+
+func TestReminderDue(t *testing.T) {
+	now := time.Date(2024, 5, 4, 12, 0, 0, 0, time.UTC)
+	prefs := models.NotificationPreferences{ReminderHours: 3}
+
+	assert.True(t, reminderDue(prefs, now.Add(2*time.Hour), now))
+	assert.True(t, reminderDue(prefs, now.Add(3*time.Hour), now))
+	assert.False(t, reminderDue(prefs, now.Add(4*time.Hour), now))
+
+	prefs.ReminderHours = 0
+	assert.False(t, reminderDue(prefs, now.Add(3*time.Hour), now))
+}
+
+func TestDedupeKey(t *testing.T) {
+	userID := primitive.NewObjectID()
+	fixture := models.Fixture{ID: primitive.NewObjectID(), Date: time.Now(), RescheduledAt: time.Now()}
+
+	assert.Equal(t, dedupeKey(userID, fixture, models.FinalScore), dedupeKey(userID, fixture, models.FinalScore))
+
+	first := dedupeKey(userID, fixture, models.FixtureRescheduled)
+	fixture.RescheduledAt = fixture.RescheduledAt.Add(time.Hour)
+	assert.NotEqual(t, first, dedupeKey(userID, fixture, models.FixtureRescheduled))
+}
+
+func TestDigestDue(t *testing.T) {
+	digestHour = 7
+	assert.Equal(t, time.Date(2024, 5, 4, 7, 0, 0, 0, time.UTC), digestDue(time.Date(2024, 5, 4, 9, 30, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2024, 5, 3, 7, 0, 0, 0, time.UTC), digestDue(time.Date(2024, 5, 4, 6, 59, 0, 0, time.UTC)))
+}
@@ -0,0 +1,26 @@
+package notifications
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"league/jwt"
+)
+
+func NotificationRoutes(superRoute *gin.RouterGroup) {
+	// unsubscribe from the link in every notification email, no sign in needed; GET only asks for confirmation
+	// so link scanners cannot unsubscribe anyone, mail clients POST straight away through List-Unsubscribe
+	superRoute.GET("/notifications/unsubscribe", confirmUnsubscribeHandler)
+	superRoute.POST("/notifications/unsubscribe", unsubscribeHandler)
+
+	notificationRouter := superRoute.Group("/notifications")
+	{
+		notificationRouter.Use(jwt.Middleware())
+		notificationRouter.GET("/", getNotificationsHandler)
+		notificationRouter.GET("/preferences", getPreferencesHandler)
+		notificationRouter.PUT("/preferences", updatePreferencesHandler)
+		notificationRouter.POST("/follows/teams/:id", followHandler("teams"))
+		notificationRouter.DELETE("/follows/teams/:id", unfollowHandler("teams"))
+		notificationRouter.POST("/follows/competitions/:id", followHandler("competitions"))
+		notificationRouter.DELETE("/follows/competitions/:id", unfollowHandler("competitions"))
+	}
+}
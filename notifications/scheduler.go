@@ -0,0 +1,412 @@
+package notifications
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/emails"
+	"league/models"
+
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// digestHour is the UTC hour daily digests go out, NOTIFICATION_DIGEST_HOUR overrides it
+	digestHour int = 7
+	// lookback is how far back the scheduler looks for results, lineups and reschedules
+	lookback time.Duration = 24 * time.Hour
+	// maxReminder bounds how early a kickoff reminder can be asked for
+	maxReminder time.Duration = 48 * time.Hour
+)
+
+const kickoffFormat = "02 Jan 2006 15:04 MST"
+
+// wake lets fixture changes run the scheduler straight away instead of waiting for the next tick
+var wake = make(chan struct{}, 1)
+
+// StartScheduler generates and delivers notifications every minute, and whenever a fixture changes
+func StartScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			runScheduler(time.Now())
+			select {
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+}
+
+// wakeScheduler never blocks, a run that is already queued covers the change too
+func wakeScheduler() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func runScheduler(now time.Time) {
+	if err := generate(now); err != nil {
+		fmt.Printf("could not generate notifications: %v \n", err)
+	}
+	if err := deliverPending(now); err != nil {
+		fmt.Printf("could not deliver notifications: %v \n", err)
+	}
+	if err := sendDigests(now); err != nil {
+		fmt.Printf("could not send digests: %v \n", err)
+	}
+}
+
+// fixtureEvents maps each event to the fixtures it currently applies to
+func fixtureEvents(now time.Time) map[models.NotificationEvent]bson.M {
+	return map[models.NotificationEvent]bson.M{
+		models.KickoffReminder:    {"status": models.Pending, "date": bson.M{"$gt": now, "$lte": now.Add(maxReminder)}},
+		models.FinalScore:         {"status": models.Completed, "updated_at": bson.M{"$gte": now.Add(-lookback)}},
+		models.LineupPublished:    {"lineup_published_at": bson.M{"$gte": now.Add(-lookback)}},
+		models.FixtureRescheduled: {"rescheduled_at": bson.M{"$gte": now.Add(-lookback)}},
+	}
+}
+
+// dedupeKey identifies a notification; times are part of it so a second reschedule is news again
+func dedupeKey(userID primitive.ObjectID, fixture models.Fixture, event models.NotificationEvent) string {
+	key := fmt.Sprintf("%s:%s:%s", userID.Hex(), fixture.ID.Hex(), event)
+	switch event {
+	case models.KickoffReminder:
+		key += fmt.Sprintf(":%d", fixture.Date.Unix())
+	case models.LineupPublished:
+		key += fmt.Sprintf(":%d", fixture.LineupPublishedAt.Unix())
+	case models.FixtureRescheduled:
+		key += fmt.Sprintf(":%d", fixture.RescheduledAt.Unix())
+	}
+	return key
+}
+
+// reminderDue says whether a follower's kickoff reminder should go out yet
+func reminderDue(prefs models.NotificationPreferences, kickoff time.Time, now time.Time) bool {
+	hours := prefs.ReminderHours
+	if hours <= 0 {
+		hours = DefaultReminderHours
+	}
+	return !kickoff.Add(-time.Duration(hours) * time.Hour).After(now)
+}
+
+// generate records a pending notification for every follower of every fixture with news
+func generate(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	names := map[primitive.ObjectID]string{}
+	for event, filter := range fixtureEvents(now) {
+		cursor, err := fixtureCollection.Find(ctx, db.NotDeleted(filter))
+		if err != nil {
+			return fmt.Errorf("failed to find fixtures: %v", err)
+		}
+		var fixtures []models.Fixture
+		if err := cursor.All(ctx, &fixtures); err != nil {
+			return fmt.Errorf("failed to decode fixtures: %v", err)
+		}
+
+		for _, fixture := range fixtures {
+			followers, err := findFollowers(ctx, fixture, event)
+			if err != nil {
+				return err
+			}
+			for _, prefs := range followers {
+				if event == models.KickoffReminder && !reminderDue(prefs, fixture.Date, now) {
+					continue
+				}
+				notification := models.Notification{
+					UserID:          prefs.UserID,
+					FixtureID:       fixture.ID,
+					Event:           event,
+					DedupeKey:       dedupeKey(prefs.UserID, fixture, event),
+					HomeTeam:        teamName(ctx, names, fixture.HomeTeamID),
+					AwayTeam:        teamName(ctx, names, fixture.AwayTeamID),
+					HomeGoals:       fixture.Home.Goals,
+					AwayGoals:       fixture.Away.Goals,
+					Kickoff:         fixture.Date,
+					PreviousKickoff: fixture.PreviousDate,
+					Status:          models.NotificationPending,
+					CreatedAt:       now,
+				}
+				_, err := notificationCollection.UpdateOne(ctx,
+					bson.M{"dedupe_key": notification.DedupeKey},
+					bson.M{"$setOnInsert": notification},
+					options.Update().SetUpsert(true),
+				)
+				if err != nil {
+					return fmt.Errorf("could not record notification: %v", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func findFollowers(ctx context.Context, fixture models.Fixture, event models.NotificationEvent) ([]models.NotificationPreferences, error) {
+	filter := bson.M{
+		"events": event,
+		"$or": []bson.M{
+			{"teams": bson.M{"$in": []primitive.ObjectID{fixture.HomeTeamID, fixture.AwayTeamID}}},
+			{"competitions": fixture.CompetitionID},
+		},
+	}
+	// followers whose account is in the trash hear nothing until it is restored
+	pipeline := bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$lookup": bson.M{
+			"from": userCollection.Name(),
+			"let":  bson.M{"user_id": "$user_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": db.NotDeleted(bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$user_id"}}})},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": "user",
+		}},
+		bson.M{"$match": bson.M{"user": bson.M{"$ne": bson.A{}}}},
+		bson.M{"$project": bson.M{"user": 0}},
+	}
+	cursor, err := preferenceCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find followers: %v", err)
+	}
+	followers := make([]models.NotificationPreferences, 0)
+	if err := cursor.All(ctx, &followers); err != nil {
+		return nil, fmt.Errorf("failed to decode followers: %v", err)
+	}
+	return followers, nil
+}
+
+func teamName(ctx context.Context, names map[primitive.ObjectID]string, ID primitive.ObjectID) string {
+	if name, ok := names[ID]; ok {
+		return name
+	}
+	var team models.Team
+	if err := teamCollection.FindOne(ctx, bson.M{"_id": ID}).Decode(&team); err != nil {
+		return ""
+	}
+	names[ID] = team.Name
+	return team.Name
+}
+
+// recipient is who a notification is for and how to reach them; nil means it should be skipped
+type recipient struct {
+	prefs models.NotificationPreferences
+	user  models.User
+}
+
+func loadRecipient(ctx context.Context, recipients map[primitive.ObjectID]*recipient, userID primitive.ObjectID) *recipient {
+	if r, ok := recipients[userID]; ok {
+		return r
+	}
+	recipients[userID] = nil
+
+	var r recipient
+	if err := preferenceCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&r.prefs); err != nil {
+		return nil
+	}
+	if err := userCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": userID})).Decode(&r.user); err != nil {
+		return nil
+	}
+	if r.user.IsErased() || r.user.IsSuspended() || !hasEmailChannel(r.prefs) {
+		return nil
+	}
+	recipients[userID] = &r
+	return &r
+}
+
+func hasEmailChannel(prefs models.NotificationPreferences) bool {
+	for _, channel := range prefs.Channels {
+		if channel == models.EmailChannel {
+			return true
+		}
+	}
+	return false
+}
+
+func unsubscribeLink(prefs models.NotificationPreferences) string {
+	return fmt.Sprintf("%s/unsubscribe?token=%s", strings.TrimRight(appURL, "/"), prefs.UnsubscribeToken)
+}
+
+// oneClickLink is sent in the List-Unsubscribe header, mail clients POST to it without showing a page
+func oneClickLink(prefs models.NotificationPreferences) string {
+	return fmt.Sprintf("%s/notifications/unsubscribe?token=%s", strings.TrimRight(apiURL, "/"), prefs.UnsubscribeToken)
+}
+
+func emailData(notification models.Notification) emails.NotificationData {
+	data := emails.NotificationData{
+		Event:     string(notification.Event),
+		HomeTeam:  notification.HomeTeam,
+		AwayTeam:  notification.AwayTeam,
+		HomeGoals: notification.HomeGoals,
+		AwayGoals: notification.AwayGoals,
+		Kickoff:   notification.Kickoff.UTC().Format(kickoffFormat),
+	}
+	if !notification.PreviousKickoff.IsZero() {
+		data.PreviousKickoff = notification.PreviousKickoff.UTC().Format(kickoffFormat)
+	}
+	return data
+}
+
+// stale notifications are not worth sending, such as a reminder for a match that has started
+func stale(notification models.Notification, now time.Time) bool {
+	return notification.Event == models.KickoffReminder && notification.Kickoff.Before(now)
+}
+
+func markNotifications(ctx context.Context, IDs []primitive.ObjectID, status models.NotificationStatus, now time.Time) error {
+	if len(IDs) == 0 {
+		return nil
+	}
+	set := bson.M{"status": status}
+	if status == models.NotificationSent {
+		set["sent_at"] = now
+	}
+	_, err := notificationCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": IDs}}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("could not update notifications: %v", err)
+	}
+	return nil
+}
+
+// deliverPending emails notifications as they happen to users who do not want a digest, oldest first.
+// Digest users are left out of the batch, their notifications wait for the digest and must not crowd out the others
+func deliverPending(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": models.NotificationPending}}},
+		{{Key: "$sort", Value: bson.M{"created_at": 1}}},
+		{{Key: "$lookup", Value: bson.M{"from": preferenceCollection.Name(), "localField": "user_id", "foreignField": "user_id", "as": "prefs"}}},
+		{{Key: "$match", Value: bson.M{"prefs.digest": bson.M{"$ne": true}}}},
+		{{Key: "$limit", Value: 500}},
+		{{Key: "$project", Value: bson.M{"prefs": 0}}},
+	}
+	cursor, err := notificationCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to find notifications: %v", err)
+	}
+	var pending []models.Notification
+	if err := cursor.All(ctx, &pending); err != nil {
+		return fmt.Errorf("failed to decode notifications: %v", err)
+	}
+
+	recipients := map[primitive.ObjectID]*recipient{}
+	var sent, skipped []primitive.ObjectID
+	for _, notification := range pending {
+		r := loadRecipient(ctx, recipients, notification.UserID)
+		if r == nil || stale(notification, now) {
+			skipped = append(skipped, notification.ID)
+			continue
+		}
+		if r.prefs.Digest {
+			continue
+		}
+
+		data := emailData(notification)
+		data.UnsubscribeLink = unsubscribeLink(r.prefs)
+		if err := emails.SendNotificationEmail(r.user.Email, r.user.Locale, data, oneClickLink(r.prefs)); err != nil {
+			fmt.Printf("could not send notification: %v \n", err)
+			continue
+		}
+		sent = append(sent, notification.ID)
+	}
+
+	if err := markNotifications(ctx, sent, models.NotificationSent, now); err != nil {
+		return err
+	}
+	return markNotifications(ctx, skipped, models.NotificationSkipped, now)
+}
+
+// digestDue is the most recent digest time at or before now
+func digestDue(now time.Time) time.Time {
+	now = now.UTC()
+	due := time.Date(now.Year(), now.Month(), now.Day(), digestHour, 0, 0, 0, time.UTC)
+	if due.After(now) {
+		due = due.AddDate(0, 0, -1)
+	}
+	return due
+}
+
+// sendDigests mails each digest user what piled up since their last digest, once a day
+func sendDigests(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	due := digestDue(now)
+	cursor, err := preferenceCollection.Find(ctx, bson.M{
+		"digest": true,
+		"$or": []bson.M{
+			{"last_digest_at": bson.M{"$lt": due}},
+			{"last_digest_at": bson.M{"$exists": false}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find digest subscribers: %v", err)
+	}
+	var subscribers []models.NotificationPreferences
+	if err := cursor.All(ctx, &subscribers); err != nil {
+		return fmt.Errorf("failed to decode digest subscribers: %v", err)
+	}
+
+	recipients := map[primitive.ObjectID]*recipient{}
+	for _, prefs := range subscribers {
+		if err := sendDigest(ctx, recipients, prefs, now); err != nil {
+			fmt.Printf("could not send digest to %v: %v \n", prefs.UserID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func sendDigest(ctx context.Context, recipients map[primitive.ObjectID]*recipient, prefs models.NotificationPreferences, now time.Time) error {
+	cursor, err := notificationCollection.Find(ctx,
+		bson.M{"user_id": prefs.UserID, "status": models.NotificationPending},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	var pending []models.Notification
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+
+	r := loadRecipient(ctx, recipients, prefs.UserID)
+	var items []emails.NotificationData
+	var sent, skipped []primitive.ObjectID
+	for _, notification := range pending {
+		if r == nil || stale(notification, now) {
+			skipped = append(skipped, notification.ID)
+			continue
+		}
+		items = append(items, emailData(notification))
+		sent = append(sent, notification.ID)
+	}
+
+	if len(items) > 0 {
+		err := emails.SendDigestEmail(r.user.Email, r.user.Locale, emails.DigestData{
+			Items:           items,
+			UnsubscribeLink: unsubscribeLink(r.prefs),
+		}, oneClickLink(r.prefs))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := markNotifications(ctx, sent, models.NotificationSent, now); err != nil {
+		return err
+	}
+	if err := markNotifications(ctx, skipped, models.NotificationSkipped, now); err != nil {
+		return err
+	}
+	_, err = preferenceCollection.UpdateOne(ctx, bson.M{"_id": prefs.ID}, bson.M{"$set": bson.M{"last_digest_at": now}})
+	return err
+}
@@ -0,0 +1,357 @@
+package notifications
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/models"
+
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var preferenceCollection *mongo.Collection = db.GetCollection(db.MongoClient, "notification_preferences")
+var notificationCollection *mongo.Collection = db.GetCollection(db.MongoClient, "notifications")
+var fixtureCollection *mongo.Collection = db.GetCollection(db.MongoClient, "fixtures")
+var teamCollection *mongo.Collection = db.GetCollection(db.MongoClient, "teams")
+var competitionCollection *mongo.Collection = db.GetCollection(db.MongoClient, "competitions")
+var userCollection *mongo.Collection = db.GetCollection(db.MongoClient, "users")
+var duration time.Duration = 10 * time.Second
+
+var ErrInvalidUnsubscribeLink = errors.New("invalid unsubscribe link")
+
+// DefaultReminderHours is how long before kickoff reminders go out unless a user picks otherwise
+const DefaultReminderHours = 2
+
+var appURL string
+
+// apiURL is where this api is reached from outside, mail clients post one-click unsubscribes to it
+var apiURL string
+
+func init() {
+	appURL = os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:8000"
+	}
+	apiURL = os.Getenv("API_URL")
+	if apiURL == "" {
+		apiURL = strings.TrimRight(appURL, "/") + "/api/v1"
+	}
+	if hour, err := strconv.Atoi(os.Getenv("NOTIFICATION_DIGEST_HOUR")); err == nil && hour >= 0 && hour < 24 {
+		digestHour = hour
+	}
+
+	//check for user index, one preferences document per user
+	exists, err := db.IsIndexExists(context.Background(), preferenceCollection, "user_id")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !exists {
+		err = db.IndexField(*preferenceCollection, "user_id", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	//check for unsubscribe token index
+	tokenExists, err := db.IsIndexExists(context.Background(), preferenceCollection, "unsubscribe_token")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !tokenExists {
+		err = db.IndexField(*preferenceCollection, "unsubscribe_token", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	//check for dedupe index, it keeps the scheduler from notifying twice
+	dedupeExists, err := db.IsIndexExists(context.Background(), notificationCollection, "dedupe_key")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !dedupeExists {
+		err = db.IndexField(*notificationCollection, "dedupe_key", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+}
+
+func newUnsubscribeToken() (string, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// defaultPreferences is what a user gets the first time they follow something
+func defaultPreferences(userID primitive.ObjectID) models.NotificationPreferences {
+	return models.NotificationPreferences{
+		UserID:        userID,
+		Teams:         []primitive.ObjectID{},
+		Competitions:  []primitive.ObjectID{},
+		Channels:      []models.NotificationChannel{models.EmailChannel},
+		Events:        models.NotificationEvents,
+		ReminderHours: DefaultReminderHours,
+	}
+}
+
+func getPreferences(userID primitive.ObjectID) (*models.NotificationPreferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var prefs models.NotificationPreferences
+	err := preferenceCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&prefs)
+	if err == mongo.ErrNoDocuments {
+		prefs = defaultPreferences(userID)
+		return &prefs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch notification preferences: %v", err)
+	}
+	return &prefs, nil
+}
+
+// insertDefaults only applies to a new preferences document, fields being changed are left out
+func insertDefaults(userID primitive.ObjectID, skip ...string) (bson.M, error) {
+	token, err := newUnsubscribeToken()
+	if err != nil {
+		return nil, err
+	}
+	defaults := defaultPreferences(userID)
+	fields := bson.M{
+		"teams":             defaults.Teams,
+		"competitions":      defaults.Competitions,
+		"channels":          defaults.Channels,
+		"events":            defaults.Events,
+		"reminder_hours":    defaults.ReminderHours,
+		"digest":            false,
+		"unsubscribe_token": token,
+		"created_at":        time.Now(),
+	}
+	for _, field := range skip {
+		delete(fields, field)
+	}
+	return fields, nil
+}
+
+func savePreferences(userID primitive.ObjectID, req PreferencesRequest) (*models.NotificationPreferences, error) {
+	for _, event := range req.Events {
+		if !models.IsValidNotificationEvent(event) {
+			return nil, fmt.Errorf("%v is not a valid notification event", event)
+		}
+	}
+	if err := checkExists(teamCollection, req.Teams, "team"); err != nil {
+		return nil, err
+	}
+	if err := checkExists(competitionCollection, req.Competitions, "competition"); err != nil {
+		return nil, err
+	}
+
+	set := bson.M{
+		"teams":          nonNil(req.Teams),
+		"competitions":   nonNil(req.Competitions),
+		"channels":       req.Channels,
+		"events":         req.Events,
+		"reminder_hours": req.ReminderHours,
+		"digest":         req.Digest,
+		"updated_at":     time.Now(),
+	}
+	if req.Channels == nil {
+		set["channels"] = []models.NotificationChannel{}
+	}
+	if req.Events == nil {
+		set["events"] = []models.NotificationEvent{}
+	}
+	if req.ReminderHours == 0 {
+		set["reminder_hours"] = DefaultReminderHours
+	}
+
+	onInsert, err := insertDefaults(userID, "teams", "competitions", "channels", "events", "reminder_hours", "digest")
+	if err != nil {
+		return nil, err
+	}
+	return upsertPreferences(userID, bson.M{"$set": set, "$setOnInsert": onInsert})
+}
+
+// follow adds a team or competition, kind being "teams" or "competitions"
+func follow(userID primitive.ObjectID, kind string, ID string) (*models.NotificationPreferences, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+	collection, name := teamCollection, "team"
+	if kind == "competitions" {
+		collection, name = competitionCollection, "competition"
+	}
+	if err := checkExists(collection, []primitive.ObjectID{objID}, name); err != nil {
+		return nil, err
+	}
+
+	onInsert, err := insertDefaults(userID, kind)
+	if err != nil {
+		return nil, err
+	}
+	return upsertPreferences(userID, bson.M{
+		"$addToSet":    bson.M{kind: objID},
+		"$set":         bson.M{"updated_at": time.Now()},
+		"$setOnInsert": onInsert,
+	})
+}
+
+func unfollow(userID primitive.ObjectID, kind string, ID string) (*models.NotificationPreferences, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+	onInsert, err := insertDefaults(userID, kind)
+	if err != nil {
+		return nil, err
+	}
+	return upsertPreferences(userID, bson.M{
+		"$pull":        bson.M{kind: objID},
+		"$set":         bson.M{"updated_at": time.Now()},
+		"$setOnInsert": onInsert,
+	})
+}
+
+func upsertPreferences(userID primitive.ObjectID, update bson.M) (*models.NotificationPreferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var prefs models.NotificationPreferences
+	err := preferenceCollection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID},
+		update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&prefs)
+	if err != nil {
+		return nil, fmt.Errorf("could not save notification preferences: %v", err)
+	}
+	return &prefs, nil
+}
+
+func checkExists(collection *mongo.Collection, IDs []primitive.ObjectID, name string) error {
+	if len(IDs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": IDs}})
+	if err != nil {
+		return fmt.Errorf("failed to check %v: %v", name, err)
+	}
+	if int(count) != len(IDs) {
+		return fmt.Errorf("%v not found", name)
+	}
+	return nil
+}
+
+func nonNil(IDs []primitive.ObjectID) []primitive.ObjectID {
+	if IDs == nil {
+		return []primitive.ObjectID{}
+	}
+	return IDs
+}
+
+// unsubscribe turns off one event, or every event when event is empty, for the owner of the token
+func unsubscribe(token string, event string) error {
+	if token == "" {
+		return ErrInvalidUnsubscribeLink
+	}
+	update := bson.M{"$set": bson.M{"events": []models.NotificationEvent{}, "updated_at": time.Now()}}
+	if event != "" {
+		if !models.IsValidNotificationEvent(models.NotificationEvent(event)) {
+			return fmt.Errorf("%v is not a valid notification event", event)
+		}
+		update = bson.M{"$pull": bson.M{"events": event}, "$set": bson.M{"updated_at": time.Now()}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	result, err := preferenceCollection.UpdateOne(ctx, bson.M{"unsubscribe_token": token}, update)
+	if err != nil {
+		return fmt.Errorf("could not unsubscribe: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidUnsubscribeLink
+	}
+
+	// nothing is sent anymore for the dropped events, including what was waiting for the digest
+	filter := bson.M{"status": models.NotificationPending}
+	var prefs models.NotificationPreferences
+	if err := preferenceCollection.FindOne(ctx, bson.M{"unsubscribe_token": token}).Decode(&prefs); err != nil {
+		return nil
+	}
+	filter["user_id"] = prefs.UserID
+	if event != "" {
+		filter["event"] = event
+	}
+	if _, err := notificationCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": models.NotificationSkipped}}); err != nil {
+		fmt.Printf("could not skip pending notifications: %v \n", err)
+	}
+	return nil
+}
+
+func getNotifications(userID primitive.ObjectID, pageNumber string, pageSize string) ([]models.Notification, int64, int64, int64, error) {
+	perPage := int64(15)
+	page := int64(1)
+
+	if pageSize != "" {
+		if perPageNum, err := strconv.Atoi(pageSize); err == nil {
+			perPage = int64(perPageNum)
+		}
+	}
+
+	if pageNumber != "" {
+		if num, err := strconv.Atoi(pageNumber); err == nil {
+			page = int64(num)
+		}
+	}
+
+	offset := (page - 1) * perPage
+	filter := bson.M{"user_id": userID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	fOpt := options.FindOptions{Limit: &perPage, Skip: &offset, Sort: bson.D{{Key: "created_at", Value: -1}}}
+
+	total, err := notificationCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to count notifications: %v", err)
+	}
+
+	cursor, err := notificationCollection.Find(ctx, filter, &fOpt)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to find notifications: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	notifications := make([]models.Notification, 0)
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to decode notifications: %v", err)
+	}
+
+	return notifications, total, page, perPage, nil
+}
@@ -0,0 +1,12 @@
+package notifications
+
+import (
+	"league/events"
+)
+
+func init() {
+	events.SubscribeAsync(func(events.FixtureScoreChanged) error { wakeScheduler(); return nil })
+	events.SubscribeAsync(func(events.FixtureStatusChanged) error { wakeScheduler(); return nil })
+	events.SubscribeAsync(func(events.FixtureRescheduled) error { wakeScheduler(); return nil })
+	events.SubscribeAsync(func(events.LineupPublished) error { wakeScheduler(); return nil })
+}
@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockServer is a minimal OpenID provider serving discovery, keys and a token endpoint
+type mockServer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	verifier string
+	claims   jwt.MapClaims
+}
+
+func newMockServer(t *testing.T) *mockServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	m := &mockServer{key: key}
+	mux := http.NewServeMux()
+	m.Server = httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		if r.Form.Get("code_verifier") != m.verifier {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(t, m.claims),
+		})
+	})
+	return m
+}
+
+func (m *mockServer) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(m.key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	provider := NewProvider("local", server.URL, "league", "secret", "http://localhost:8000/callback")
+	pkce, err := NewPKCE()
+	assert.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL("state", "nonce", pkce.Challenge)
+	assert.NoError(t, err)
+	parsed, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+	assert.Equal(t, pkce.Challenge, parsed.Query().Get("code_challenge"))
+
+	server.verifier = pkce.Verifier
+	server.claims = jwt.MapClaims{
+		"iss":            server.URL,
+		"aud":            "league",
+		"sub":            "subject-1",
+		"email":          "fan@example.com",
+		"email_verified": true,
+		"nonce":          "nonce",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+
+	token, err := provider.Exchange("code", pkce.Verifier)
+	assert.NoError(t, err)
+
+	claims, err := provider.VerifyIDToken(token.IDToken, "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, "subject-1", claims.Subject)
+	assert.Equal(t, "fan@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+}
+
+func TestVerifyIDToken_Rejects(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	provider := NewProvider("local", server.URL, "league", "", "")
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   server.URL,
+			"aud":   "league",
+			"sub":   "subject-1",
+			"nonce": "nonce",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := valid()
+			test.modify(claims)
+			_, err := provider.VerifyIDToken(server.sign(t, claims), "nonce")
+			assert.Error(t, err)
+		})
+	}
+}
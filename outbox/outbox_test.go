@@ -0,0 +1,200 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/emails"
+	"league/models"
+)
+
+func TestBackoff(t *testing.T) {
+	BaseBackoff = 30 * time.Second
+	MaxBackoff = time.Hour
+
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, time.Hour, Backoff(12))
+}
+
+// failingMailer stands in for an SMTP server that is down
+type failingMailer struct{}
+
+func (failingMailer) Send(msg emails.Message) error {
+	return errors.New("smtp is down")
+}
+
+// insertMessage stores msg as due long before anything else so claim picks it first
+func insertMessage(t *testing.T, msg models.OutboxMessage) primitive.ObjectID {
+	msg.From = "League <no-reply@localhost>"
+	msg.To = []string{"fan@example.com"}
+	msg.Subject = "Your code"
+	msg.HTML = "<p>1234</p>"
+	msg.Text = "1234"
+	msg.Headers = map[string]string{"List-Unsubscribe": "<https://example.com/unsubscribe>"}
+	if msg.Status == "" {
+		msg.Status = models.OutboxQueued
+	}
+	msg.NextAttemptAt = time.Unix(0, 0)
+	msg.CreatedAt = time.Now()
+	msg.UpdatedAt = time.Now()
+
+	result, err := outboxCollection.InsertOne(context.Background(), msg)
+	assert.NoError(t, err)
+	ID := result.InsertedID.(primitive.ObjectID)
+	t.Cleanup(func() {
+		outboxCollection.DeleteOne(context.Background(), bson.M{"_id": ID})
+	})
+	return ID
+}
+
+func claimMessage(t *testing.T, ID primitive.ObjectID) *models.OutboxMessage {
+	msg, err := claim()
+	assert.NoError(t, err)
+	if assert.NotNil(t, msg) {
+		assert.Equal(t, ID, msg.ID)
+	}
+	return msg
+}
+
+func TestClaim(t *testing.T) {
+	ID := insertMessage(t, models.OutboxMessage{})
+
+	msg := claimMessage(t, ID)
+	assert.Equal(t, models.OutboxSending, msg.Status)
+	assert.Equal(t, 1, msg.Attempts)
+	assert.True(t, msg.LockedUntil.After(time.Now()))
+
+	// a locked message is not handed to a second worker
+	other, err := claim()
+	assert.NoError(t, err)
+	if other != nil {
+		assert.NotEqual(t, ID, other.ID)
+	}
+}
+
+func TestClaim_StaleLock(t *testing.T) {
+	// the worker sending this one died before it finished
+	ID := insertMessage(t, models.OutboxMessage{
+		Status:      models.OutboxSending,
+		Attempts:    1,
+		LockedUntil: time.Now().Add(-time.Minute),
+	})
+
+	msg := claimMessage(t, ID)
+	assert.Equal(t, models.OutboxSending, msg.Status)
+	assert.Equal(t, 2, msg.Attempts)
+	assert.True(t, msg.LockedUntil.After(time.Now()))
+}
+
+func TestDeliver(t *testing.T) {
+	memory := &emails.MemoryMailer{}
+	emails.SetMailer(memory)
+	defer emails.SetMailer(emails.LogMailer{})
+
+	ID := insertMessage(t, models.OutboxMessage{})
+	msg := claimMessage(t, ID)
+	assert.NoError(t, deliver(msg))
+
+	sent, ok := memory.Last()
+	assert.True(t, ok)
+	assert.Equal(t, "<p>1234</p>", sent.HTML)
+	assert.Equal(t, "<https://example.com/unsubscribe>", sent.Headers["List-Unsubscribe"])
+
+	// the codes in a delivered body are not kept
+	stored, err := GetWithBody(ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, models.OutboxSent, stored.Status)
+	assert.False(t, stored.SentAt.IsZero())
+	assert.Empty(t, stored.HTML)
+	assert.Empty(t, stored.Text)
+	assert.Empty(t, stored.Headers)
+}
+
+func TestDeliver_Failure(t *testing.T) {
+	emails.SetMailer(failingMailer{})
+	defer emails.SetMailer(emails.LogMailer{})
+
+	ID := insertMessage(t, models.OutboxMessage{})
+	msg := claimMessage(t, ID)
+	assert.Error(t, deliver(msg))
+
+	// it goes back in the queue and waits before the next attempt
+	stored, err := GetWithBody(ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, models.OutboxQueued, stored.Status)
+	assert.Equal(t, "smtp is down", stored.LastError)
+	assert.True(t, stored.NextAttemptAt.After(time.Now()))
+	assert.Equal(t, "<p>1234</p>", stored.HTML)
+}
+
+func TestDeliver_DeadLetter(t *testing.T) {
+	emails.SetMailer(failingMailer{})
+	defer emails.SetMailer(emails.LogMailer{})
+
+	ID := insertMessage(t, models.OutboxMessage{Attempts: MaxAttempts - 1})
+	msg := claimMessage(t, ID)
+	assert.Equal(t, MaxAttempts, msg.Attempts)
+	assert.Error(t, deliver(msg))
+
+	stored, err := Get(ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, models.OutboxFailed, stored.Status)
+	assert.Equal(t, "smtp is down", stored.LastError)
+
+	// dead-lettered messages are left alone by the workers
+	other, err := claim()
+	assert.NoError(t, err)
+	if other != nil {
+		assert.NotEqual(t, ID, other.ID)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ID := insertMessage(t, models.OutboxMessage{Status: models.OutboxFailed, Attempts: MaxAttempts, LastError: "smtp is down"})
+
+	msg, err := Retry(ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, models.OutboxQueued, msg.Status)
+	assert.Equal(t, 0, msg.Attempts)
+	assert.False(t, msg.NextAttemptAt.After(time.Now()))
+	assert.Empty(t, msg.HTML)
+
+	// only dead-lettered messages can be retried
+	_, err = Retry(ID.Hex())
+	assert.Equal(t, ErrNotRetryable, err)
+
+	_, err = Retry(primitive.NewObjectID().Hex())
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNotRetryable, err)
+}
+
+func TestGet_HidesBody(t *testing.T) {
+	ID := insertMessage(t, models.OutboxMessage{})
+
+	msg, err := Get(ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, "Your code", msg.Subject)
+	assert.Empty(t, msg.HTML)
+	assert.Empty(t, msg.Text)
+	assert.Empty(t, msg.Headers)
+
+	msg, err = GetWithBody(ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>1234</p>", msg.HTML)
+	assert.Equal(t, "1234", msg.Text)
+	assert.NotEmpty(t, msg.Headers)
+
+	messages, _, _, _, err := List(string(models.OutboxQueued), "", "100")
+	assert.NoError(t, err)
+	for _, listed := range messages {
+		assert.Empty(t, listed.HTML)
+	}
+}
@@ -0,0 +1,299 @@
+package outbox
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/emails"
+	"league/models"
+	"league/worker"
+
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var outboxCollection *mongo.Collection = db.GetCollection(db.MongoClient, "email_outbox")
+var duration time.Duration = 10 * time.Second
+
+// ErrNotRetryable is returned when retrying a message that is not in the dead-letter state
+var ErrNotRetryable = errors.New("only failed messages can be retried")
+
+var (
+	// Workers is how many messages are delivered at once
+	Workers int = worker.EnvInt("OUTBOX_WORKERS", 4)
+	// MaxAttempts is how often a message is tried before it is dead-lettered
+	MaxAttempts int = worker.EnvInt("OUTBOX_MAX_ATTEMPTS", 8)
+	// BaseBackoff doubles after every failed attempt up to MaxBackoff
+	BaseBackoff time.Duration = time.Duration(worker.EnvInt("OUTBOX_BACKOFF_SECONDS", 30)) * time.Second
+	MaxBackoff  time.Duration = time.Hour
+	// pollInterval is how long an idle worker waits before looking again
+	pollInterval time.Duration = 2 * time.Second
+	// sendTimeout is how long a message stays locked while a worker sends it
+	sendTimeout time.Duration = 5 * time.Minute
+	// Retention is how long a sent message is kept before it is removed
+	Retention time.Duration = time.Duration(worker.EnvInt("OUTBOX_RETENTION_DAYS", 30)) * 24 * time.Hour
+)
+
+// withoutBody leaves out the bodies and headers, they hold sign in codes and links and are only shown to super-admins
+var withoutBody = bson.M{"html": 0, "text": 0, "headers": 0}
+
+func init() {
+	//check for status index, workers look messages up by it
+	exists, err := db.IsIndexExists(context.Background(), outboxCollection, "status")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !exists {
+		err = db.IndexCompound(*outboxCollection, bson.M{"status": 1, "next_attempt_at": 1}, 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	// only sent messages have sent_at, queued and dead-lettered ones are kept until they are delivered
+	if err := db.IndexTTL(*outboxCollection, "sent_at", Retention); err != nil {
+		fmt.Println("Failed to index:", err)
+	}
+}
+
+// queue is the emails.Mailer that writes to the outbox instead of sending
+type queue struct{}
+
+func (queue) Send(msg emails.Message) error {
+	return Enqueue(msg)
+}
+
+// Enqueue stores a message for the workers to deliver
+func Enqueue(msg emails.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	now := time.Now()
+	_, err := outboxCollection.InsertOne(ctx, models.OutboxMessage{
+		From:          msg.From,
+		To:            msg.To,
+		Subject:       msg.Subject,
+		HTML:          msg.HTML,
+		Text:          msg.Text,
+		Headers:       msg.Headers,
+		Status:        models.OutboxQueued,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		return fmt.Errorf("could not queue email: %v", err)
+	}
+	return nil
+}
+
+// Backoff is how long to wait after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	return worker.Backoff(BaseBackoff, MaxBackoff, attempts)
+}
+
+// claim locks the next due message for one worker; stale locks from crashed workers are taken over
+func claim() (*models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"$or": []bson.M{
+		{"status": models.OutboxQueued, "next_attempt_at": bson.M{"$lte": now}},
+		{"status": models.OutboxSending, "locked_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": models.OutboxSending, "locked_until": now.Add(sendTimeout), "updated_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+
+	var msg models.OutboxMessage
+	found, err := worker.Claim(ctx, outboxCollection, filter, update, &msg)
+	if err != nil {
+		return nil, fmt.Errorf("could not claim email: %v", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return &msg, nil
+}
+
+// deliver sends a claimed message and records the outcome
+func deliver(msg *models.OutboxMessage) error {
+	sendErr := emails.Deliver(emails.Message{
+		From:    msg.From,
+		To:      msg.To,
+		Subject: msg.Subject,
+		HTML:    msg.HTML,
+		Text:    msg.Text,
+		Headers: msg.Headers,
+		SentAt:  time.Now(),
+	})
+
+	now := time.Now()
+	set := bson.M{"updated_at": now}
+	unset := bson.M{"locked_until": ""}
+	switch {
+	case sendErr == nil:
+		set["status"] = models.OutboxSent
+		set["sent_at"] = now
+		// a delivered body is not needed again and should not outlive the codes in it
+		unset["html"] = ""
+		unset["text"] = ""
+		unset["headers"] = ""
+	case msg.Attempts >= MaxAttempts:
+		set["status"] = models.OutboxFailed
+		set["last_error"] = sendErr.Error()
+	default:
+		set["status"] = models.OutboxQueued
+		set["last_error"] = sendErr.Error()
+		set["next_attempt_at"] = now.Add(Backoff(msg.Attempts))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	_, err := outboxCollection.UpdateOne(ctx, bson.M{"_id": msg.ID}, bson.M{"$set": set, "$unset": unset})
+	if err != nil {
+		return fmt.Errorf("could not update email: %v", err)
+	}
+	return sendErr
+}
+
+// work delivers the next due message, it reports false when there was none
+func work() bool {
+	msg, err := claim()
+	if err != nil {
+		fmt.Println(err)
+	}
+	if msg == nil {
+		return false
+	}
+	if err := deliver(msg); err != nil {
+		fmt.Printf("could not deliver email %v (attempt %v): %v \n", msg.ID.Hex(), msg.Attempts, err)
+	}
+	return true
+}
+
+// StartWorkers routes all emails through the outbox and starts the workers that deliver them
+func StartWorkers() {
+	emails.SetOutbox(queue{})
+	worker.Start(Workers, pollInterval, work)
+}
+
+func List(status string, pageNumber string, pageSize string) ([]models.OutboxMessage, int64, int64, int64, error) {
+	perPage := int64(15)
+	page := int64(1)
+
+	if pageSize != "" {
+		if perPageNum, err := strconv.Atoi(pageSize); err == nil {
+			perPage = int64(perPageNum)
+		}
+	}
+
+	if pageNumber != "" {
+		if num, err := strconv.Atoi(pageNumber); err == nil {
+			page = int64(num)
+		}
+	}
+
+	offset := (page - 1) * perPage
+
+	filter := bson.M{}
+	if status != "" {
+		if !models.IsValidOutboxStatus(models.OutboxStatus(status)) {
+			return nil, 0, 0, 0, fmt.Errorf("invalid status %v", status)
+		}
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	fOpt := options.FindOptions{
+		Limit:      &perPage,
+		Skip:       &offset,
+		Sort:       bson.D{{Key: "created_at", Value: -1}},
+		Projection: withoutBody,
+	}
+
+	total, err := outboxCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to count emails: %v", err)
+	}
+
+	cursor, err := outboxCollection.Find(ctx, filter, &fOpt)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to find emails: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	messages := make([]models.OutboxMessage, 0)
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to decode emails: %v", err)
+	}
+
+	return messages, total, page, perPage, nil
+}
+
+// Get returns a message without its bodies
+func Get(ID string) (*models.OutboxMessage, error) {
+	return get(ID, options.FindOne().SetProjection(withoutBody))
+}
+
+// GetWithBody returns a message with the bodies that have not been delivered yet; only super-admins may see them
+func GetWithBody(ID string) (*models.OutboxMessage, error) {
+	return get(ID, options.FindOne())
+}
+
+func get(ID string, opts *options.FindOneOptions) (*models.OutboxMessage, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var msg models.OutboxMessage
+	if err := outboxCollection.FindOne(ctx, bson.M{"_id": objID}, opts).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("email not found: %v", err)
+	}
+	return &msg, nil
+}
+
+// Retry puts a dead-lettered message back in the queue with a fresh set of attempts
+func Retry(ID string) (*models.OutboxMessage, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	now := time.Now()
+	var msg models.OutboxMessage
+	err = outboxCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": objID, "status": models.OutboxFailed},
+		bson.M{"$set": bson.M{"status": models.OutboxQueued, "attempts": 0, "next_attempt_at": now, "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(withoutBody),
+	).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		if _, getErr := Get(ID); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrNotRetryable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not retry email: %v", err)
+	}
+	return &msg, nil
+}
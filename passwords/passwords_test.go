@@ -0,0 +1,45 @@
+package passwords
+
+import (
+	"testing"
+
+	"league/helpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := Policy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true}
+
+	assert.NoError(t, policy.Check("Kickoff-Time-42"))
+	assert.Error(t, policy.Check("Sh0rt"))
+	assert.Error(t, policy.Check("alllowercase1"))
+	assert.Error(t, policy.Check("NoDigitsHere"))
+	assert.ErrorIs(t, policy.Check("Password123"), ErrBreached)
+	assert.Error(t, policy.Check("Johnsmith99", "john@example.com"))
+
+	policy.RequireSymbol = true
+	assert.Error(t, policy.Check("Kickoff42Time"))
+}
+
+func TestNeedsRehash(t *testing.T) {
+	Cost = 10
+	weak, err := helpers.HashPassword("Kickoff-Time-42", 4)
+	assert.NoError(t, err)
+	assert.True(t, NeedsRehash(weak))
+
+	strong, err := Hash("Kickoff-Time-42")
+	assert.NoError(t, err)
+	assert.False(t, NeedsRehash(strong))
+}
+
+func TestEnvInt(t *testing.T) {
+	t.Setenv("PASSWORD_HISTORY", "-1")
+	assert.Equal(t, 5, envInt("PASSWORD_HISTORY", 5))
+
+	t.Setenv("PASSWORD_HISTORY", "0")
+	assert.Equal(t, 0, envInt("PASSWORD_HISTORY", 5))
+
+	t.Setenv("PASSWORD_HISTORY", "many")
+	assert.Equal(t, 5, envInt("PASSWORD_HISTORY", 5))
+}
@@ -0,0 +1,137 @@
+package passwords
+
+import (
+	_ "embed"
+
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed breached.txt
+var breachedList string
+
+// breached holds the bundled list of common and leaked passwords, lower cased
+var breached = map[string]struct{}{}
+
+type Policy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// History is how many previous passwords may not be reused
+	History int
+}
+
+// DefaultPolicy is read from the PASSWORD_* environment variables
+var DefaultPolicy Policy = Policy{
+	MinLength:    8,
+	RequireUpper: true,
+	RequireLower: true,
+	RequireDigit: true,
+	History:      5,
+}
+
+var ErrBreached = errors.New("this password is too common or has appeared in a data breach, please choose another")
+var ErrReused = errors.New("you have used this password recently, please choose another")
+
+func init() {
+	for _, line := range strings.Split(breachedList, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	DefaultPolicy.MinLength = envInt("PASSWORD_MIN_LENGTH", DefaultPolicy.MinLength)
+	DefaultPolicy.RequireUpper = envBool("PASSWORD_REQUIRE_UPPER", DefaultPolicy.RequireUpper)
+	DefaultPolicy.RequireLower = envBool("PASSWORD_REQUIRE_LOWER", DefaultPolicy.RequireLower)
+	DefaultPolicy.RequireDigit = envBool("PASSWORD_REQUIRE_DIGIT", DefaultPolicy.RequireDigit)
+	DefaultPolicy.RequireSymbol = envBool("PASSWORD_REQUIRE_SYMBOL", DefaultPolicy.RequireSymbol)
+	DefaultPolicy.History = envInt("PASSWORD_HISTORY", DefaultPolicy.History)
+	Cost = envInt("PASSWORD_BCRYPT_COST", Cost)
+}
+
+// envInt reads a non-negative number, anything else keeps the fallback
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// IsBreached reports whether the password is on the bundled breached list
+func IsBreached(password string) bool {
+	_, found := breached[strings.ToLower(password)]
+	return found
+}
+
+// Check validates a password against the policy; personal is information like the user's email or name
+func (p Policy) Check(password string, personal ...string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if len(password) > 72 {
+		// bcrypt ignores everything past 72 bytes
+		return errors.New("password must be at most 72 characters long")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	var missing []string
+	if p.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		missing = append(missing, "a number")
+	}
+	if p.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("password must contain %s", strings.Join(missing, ", "))
+	}
+
+	if IsBreached(password) {
+		return ErrBreached
+	}
+	lowered := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.Split(value, "@")[0])
+		if len(value) >= 3 && strings.Contains(lowered, value) {
+			return errors.New("password must not contain your name or email")
+		}
+	}
+	return nil
+}
+
+// Validate checks a password against the configured policy
+func Validate(password string, personal ...string) error {
+	return DefaultPolicy.Check(password, personal...)
+}
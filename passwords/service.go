@@ -0,0 +1,124 @@
+package passwords
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"league/db"
+	"league/helpers"
+	"league/models"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var userCollection *mongo.Collection = db.GetCollection(db.MongoClient, "users")
+var duration time.Duration = 10 * time.Second
+
+// Cost is the bcrypt cost new hashes are created with; older, cheaper hashes are upgraded on login
+var Cost int = 12
+
+// Hash hashes a password with the configured cost
+func Hash(password string) (string, error) {
+	return helpers.HashPassword(password, Cost)
+}
+
+// NeedsRehash reports whether a stored hash is weaker than the configured cost
+func NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < Cost
+}
+
+// Rehash replaces a user's hash with a stronger one after they proved they know the password
+func Rehash(ID primitive.ObjectID, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	hash, err := Hash(password)
+	if err != nil {
+		return err
+	}
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": ID}, bson.M{"$set": bson.M{"password": hash}})
+	if err != nil {
+		return fmt.Errorf("could not rehash password: %v", err)
+	}
+	return nil
+}
+
+func getUser(ID primitive.ObjectID) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"_id": ID}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no user found with ID %s", ID.Hex())
+		}
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	return &user, nil
+}
+
+// Verify checks a user's current password; accounts without one, such as social sign ins, have nothing to verify
+func Verify(ID primitive.ObjectID, password string) error {
+	user, err := getUser(ID)
+	if err != nil {
+		return err
+	}
+	if user.Password != "" && !helpers.CheckPasswordHash(password, user.Password) {
+		return errors.New("current password is incorrect")
+	}
+	return nil
+}
+
+// Set validates and stores a new password, remembering the old hash so it cannot be reused
+func Set(ID primitive.ObjectID, password string) error {
+	user, err := getUser(ID)
+	if err != nil {
+		return err
+	}
+	if err := Validate(password, user.Email, user.FirstName, user.LastName); err != nil {
+		return err
+	}
+
+	previous := user.PasswordHistory
+	if user.Password != "" {
+		previous = append([]string{user.Password}, previous...)
+	}
+	if len(previous) > DefaultPolicy.History {
+		previous = previous[:DefaultPolicy.History]
+	}
+	for _, hash := range previous {
+		if helpers.CheckPasswordHash(password, hash) {
+			return ErrReused
+		}
+	}
+
+	hash, err := Hash(password)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	update := bson.M{
+		"password":         hash,
+		"password_history": previous,
+		"updated_at":       time.Now(),
+	}
+	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": ID}, bson.M{
+		"$set":   update,
+		"$unset": bson.M{"password_reset_required": ""},
+	})
+	if err != nil {
+		return fmt.Errorf("could not update password: %v", err)
+	}
+	return nil
+}
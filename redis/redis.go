@@ -110,3 +110,38 @@ func Delete(key string) error {
 	}
 	return nil
 }
+
+// Increment bumps a counter and starts its expiry when the key is first created
+func Increment(key string, expiration time.Duration) (int64, error) {
+	value, err := client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment %v in redis: %v", key, err)
+	}
+	if value == 1 && expiration > 0 {
+		if err := client.Expire(ctx, key, expiration).Err(); err != nil {
+			return 0, fmt.Errorf("failed to set expiry on %v in redis: %v", key, err)
+		}
+	}
+	return value, nil
+}
+
+// TimeToLive returns how long a key has left, or zero when it does not exist
+func TimeToLive(key string) (time.Duration, error) {
+	ttl, err := client.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read ttl of %v from redis: %v", key, err)
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Consume deletes a key and reports whether it existed, so a value can only be redeemed once
+func Consume(key string) (bool, error) {
+	deleted, err := client.Del(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to consume %v from redis: %v", key, err)
+	}
+	return deleted == 1, nil
+}
@@ -0,0 +1,22 @@
+package roles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"league/models"
+)
+
+func TestValidatePermissions(t *testing.T) {
+	// anyone with roles:write may hand out ordinary permissions
+	assert.NoError(t, validatePermissions(models.AdminRole, []models.Permission{models.FixturesWrite, "teams:*"}))
+
+	assert.EqualError(t, validatePermissions(models.SuperAdminRole, []models.Permission{"fixtures:read"}), "fixtures:read is not a valid permission")
+
+	// only super-admins can grant permissions that lead to full access
+	for _, permission := range []models.Permission{models.AllPermissions, models.RolesWrite, "roles:*", models.InvitesWrite, "invites:*"} {
+		assert.Equal(t, models.ErrPrivilegedPermission, validatePermissions(models.AdminRole, []models.Permission{permission}), permission)
+		assert.NoError(t, validatePermissions(models.SuperAdminRole, []models.Permission{permission}), permission)
+	}
+}
@@ -0,0 +1,324 @@
+package roles
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/events"
+	"league/models"
+	cisredis "league/redis"
+
+	"github.com/go-redis/redis/v8"
+
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var roleCollection *mongo.Collection = db.GetCollection(db.MongoClient, "roles")
+var userCollection *mongo.Collection = db.GetCollection(db.MongoClient, "users")
+var duration time.Duration = 10 * time.Second
+
+var roleName = regexp.MustCompile(`^[a-z][a-z0-9-]{2,31}$`)
+
+// builtInRoles are seeded on start up and can never be deleted
+var builtInRoles []models.RoleDefinition = []models.RoleDefinition{
+	{
+		Name:        models.SuperAdminRole,
+		Description: "full access to every resource",
+		Permissions: []models.Permission{models.AllPermissions},
+	},
+	{
+		Name:        models.AdminRole,
+		Description: "league administrator",
+		Permissions: []models.Permission{
+			models.FixturesWrite,
+			models.FixturesDelete,
+			models.TeamsWrite,
+			models.TeamsDelete,
+			models.PlayersWrite,
+			models.FixturesStats,
+			models.UsersRead,
+			models.EmailsRead,
+			models.EmailsWrite,
+			models.WebhooksWrite,
+			models.AuditRead,
+			models.IntegrityRead,
+			models.IntegrityWrite,
+		},
+	},
+	{
+		Name:        models.ClubAdminRole,
+		Description: "club staff managing only the clubs assigned to them",
+		Permissions: []models.Permission{
+			models.TeamsWrite,
+			models.PlayersWrite,
+			models.FixturesStats,
+		},
+	},
+	{
+		Name:        models.UserRole,
+		Description: "fan account",
+		Permissions: []models.Permission{},
+	},
+}
+
+func init() {
+	//check for name index
+	exists, err := db.IsIndexExists(context.Background(), roleCollection, "name")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !exists {
+		err = db.IndexField(*roleCollection, "name", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	if err := seedRoles(); err != nil {
+		fmt.Println("Failed to seed roles:", err)
+	}
+}
+
+func seedRoles() error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	for _, role := range builtInRoles {
+		// only insert missing roles so edits made by super-admins survive restarts
+		_, err := roleCollection.UpdateOne(ctx,
+			bson.M{"name": role.Name},
+			bson.M{"$setOnInsert": bson.M{
+				"name":        role.Name,
+				"description": role.Description,
+				"permissions": role.Permissions,
+				"built_in":    true,
+				"created_at":  time.Now(),
+				"updated_at":  time.Now(),
+			}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cacheKey(name models.Role) string {
+	return "role:" + string(name)
+}
+
+// validatePermissions checks the permissions exist and that grantor may hand them out
+func validatePermissions(grantor models.Role, permissions []models.Permission) error {
+	for _, p := range permissions {
+		if !models.IsValidPermission(p) {
+			return fmt.Errorf("%v is not a valid permission", p)
+		}
+	}
+	if grantor != models.SuperAdminRole && models.IsPrivileged(permissions) {
+		return models.ErrPrivilegedPermission
+	}
+	return nil
+}
+
+func GetRole(name models.Role) (*models.RoleDefinition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var role models.RoleDefinition
+	err := roleCollection.FindOne(ctx, bson.M{"name": name}).Decode(&role)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("role %v is not found", name)
+		}
+		return nil, fmt.Errorf("failed to fetch role: %v", err)
+	}
+	return &role, nil
+}
+
+// GetPermissions returns the permissions of a role, reading through the redis cache
+func GetPermissions(name models.Role) ([]models.Permission, error) {
+	value, err := cisredis.Retrieve(cacheKey(name))
+	if err != nil {
+		if err != redis.Nil {
+			return nil, fmt.Errorf("failed to retrieve role from Redis: %w", err)
+		}
+		role, err := GetRole(name)
+		if err != nil {
+			return nil, err
+		}
+		roleByte, err := cisredis.StoreStruct(role.Permissions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store role in Redis: %w", err)
+		}
+		if err := cisredis.Store(cacheKey(name), roleByte, 10*time.Minute); err != nil {
+			return nil, fmt.Errorf("failed to store role in Redis with expiration: %w", err)
+		}
+		return role.Permissions, nil
+	}
+
+	var permissions []models.Permission
+	if err := cisredis.UnmarshalStruct([]byte(value), &permissions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal role from Redis: %w", err)
+	}
+	return permissions, nil
+}
+
+func HasPermission(name models.Role, permission models.Permission) (bool, error) {
+	permissions, err := GetPermissions(name)
+	if err != nil {
+		return false, err
+	}
+	return models.HasPermission(permissions, permission), nil
+}
+
+func GetRoles() ([]models.RoleDefinition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := roleCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find roles: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	roles := make([]models.RoleDefinition, 0)
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, fmt.Errorf("failed to decode roles: %v", err)
+	}
+	return roles, nil
+}
+
+// CreateRole adds a custom role; grantor is the role of the user creating it
+func CreateRole(actor models.AuditActor, grantor models.Role, name models.Role, description string, permissions []models.Permission) (*models.RoleDefinition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	if !roleName.MatchString(string(name)) {
+		return nil, fmt.Errorf("%v is not a valid role name", name)
+	}
+	if err := validatePermissions(grantor, permissions); err != nil {
+		return nil, err
+	}
+
+	role := models.RoleDefinition{
+		Name:        name,
+		Description: description,
+		Permissions: permissions,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	err := db.Transaction(ctx, func(ctx context.Context) error {
+		result, err := roleCollection.InsertOne(ctx, role)
+		if err != nil {
+			return err
+		}
+		role.ID = result.InsertedID.(primitive.ObjectID)
+		return events.PublishInTransaction(ctx, events.RoleCreated{Actor: actor, Role: role})
+	})
+	if err != nil {
+		if mongoErr, ok := err.(mongo.WriteException); ok {
+			for _, e := range mongoErr.WriteErrors {
+				if e.Code == 11000 {
+					return nil, fmt.Errorf("role already exists: %s", name)
+				}
+			}
+		}
+		return nil, fmt.Errorf("could not create role: %v", err)
+	}
+
+	events.PublishCommitted(events.RoleCreated{Actor: actor, Role: role})
+	return &role, nil
+}
+
+// UpdateRole replaces the permissions of a role; grantor is the role of the user editing it
+func UpdateRole(actor models.AuditActor, grantor models.Role, name models.Role, description string, permissions []models.Permission) (*models.RoleDefinition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	// editing super-admin could lock everybody out of role management
+	if name == models.SuperAdminRole {
+		return nil, fmt.Errorf("the %v role cannot be edited", name)
+	}
+	if err := validatePermissions(grantor, permissions); err != nil {
+		return nil, err
+	}
+
+	updates := bson.M{
+		"permissions": permissions,
+		"updated_at":  time.Now(),
+	}
+	if description != "" {
+		updates["description"] = description
+	}
+
+	var before, after models.RoleDefinition
+	err := db.Transaction(ctx, func(ctx context.Context) error {
+		err := roleCollection.FindOneAndUpdate(ctx, bson.M{"name": name}, bson.M{"$set": updates}).Decode(&before)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("role %v is not found", name)
+			}
+			return fmt.Errorf("could not update role: %w", err)
+		}
+		if err := roleCollection.FindOne(ctx, bson.M{"name": name}).Decode(&after); err != nil {
+			return fmt.Errorf("failed to fetch role: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.RoleUpdated{Actor: actor, Before: before, After: after})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cisredis.Delete(cacheKey(name)); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	events.PublishCommitted(events.RoleUpdated{Actor: actor, Before: before, After: after})
+	return &after, nil
+}
+
+func DeleteRole(actor models.AuditActor, name models.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	role, err := GetRole(name)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return fmt.Errorf("the %v role is built in and cannot be deleted", name)
+	}
+
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		count, err := userCollection.CountDocuments(ctx, bson.M{"role": name})
+		if err != nil {
+			return fmt.Errorf("failed to count users: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("role %v is still assigned to %d users", name, count)
+		}
+
+		if _, err := roleCollection.DeleteOne(ctx, bson.M{"_id": role.ID}); err != nil {
+			return fmt.Errorf("failed to delete role: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.RoleDeleted{Actor: actor, Role: *role})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := cisredis.Delete(cacheKey(name)); err != nil && err != redis.Nil {
+		return err
+	}
+	events.PublishCommitted(events.RoleDeleted{Actor: actor, Role: *role})
+	return nil
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"github.com/gin-gonic/gin"
 
+	"league/admin"
+	"league/apikeys"
 	"league/auth"
+	"league/notifications"
 	"league/users"
+	"league/webhooks"
 	"league/fixtures"
 	"league/e-teams"
 )
@@ -16,4 +20,8 @@ func AddRoutes(superRoute *gin.RouterGroup) {
 	users.UserRoutes(superRoute)
 	fixtures.FixtureRoutes(superRoute)
 	teams.TeamRoutes(superRoute)
+	apikeys.APIKeyRoutes(superRoute)
+	admin.AdminRoutes(superRoute)
+	notifications.NotificationRoutes(superRoute)
+	webhooks.WebhookRoutes(superRoute)
 }
@@ -0,0 +1,305 @@
+package sessions
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/emails"
+	"league/models"
+	cisredis "league/redis"
+
+	"github.com/go-redis/redis/v8"
+
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var sessionCollection *mongo.Collection = db.GetCollection(db.MongoClient, "sessions")
+var duration time.Duration = 10 * time.Second
+
+// how long the active marker and last seen time of a session are kept in redis
+var cacheTTL time.Duration = 30 * 24 * time.Hour
+
+var ErrSessionRevoked = errors.New("this session has been signed out")
+
+func init() {
+	//check for user index
+	exists, err := db.IsIndexExists(context.Background(), sessionCollection, "user_id")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !exists {
+		err = db.IndexNormalField(*sessionCollection, "user_id", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+}
+
+func activeKey(ID primitive.ObjectID) string {
+	return fmt.Sprintf("session:%s", ID.Hex())
+}
+
+func lastSeenKey(ID primitive.ObjectID) string {
+	return fmt.Sprintf("session:%s:last_seen", ID.Hex())
+}
+
+// describeDevice turns a user agent into something a person recognises, e.g. "Chrome on Windows"
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	os := ""
+	switch {
+	case strings.Contains(ua, "iphone"):
+		os = "iPhone"
+	case strings.Contains(ua, "ipad"):
+		os = "iPad"
+	case strings.Contains(ua, "android"):
+		os = "Android"
+	case strings.Contains(ua, "windows"):
+		os = "Windows"
+	case strings.Contains(ua, "mac os"):
+		os = "macOS"
+	case strings.Contains(ua, "linux"):
+		os = "Linux"
+	}
+
+	browser := ""
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown device"
+}
+
+// Create records a sign in and alerts the user when it comes from a device they have not used before
+func Create(user *models.User, userAgent string, ip string) (*models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	session := models.Session{
+		UserID:     user.Id,
+		UserAgent:  userAgent,
+		Device:     describeDevice(userAgent),
+		IP:         ip,
+		LastSeenAt: time.Now(),
+		CreatedAt:  time.Now(),
+	}
+
+	previous, err := sessionCollection.CountDocuments(ctx, bson.M{"user_id": user.Id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sessions: %v", err)
+	}
+	known, err := sessionCollection.CountDocuments(ctx, bson.M{"user_id": user.Id, "user_agent": userAgent})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sessions: %v", err)
+	}
+
+	result, err := sessionCollection.InsertOne(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("could not create session: %v", err)
+	}
+	session.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := cisredis.Store(activeKey(session.ID), user.Id.Hex(), cacheTTL); err != nil {
+		return nil, err
+	}
+
+	// the very first sign in is not worth an alert
+	if previous > 0 && known == 0 {
+		sendNewDeviceEmail(user.Email, user.Locale, session)
+	}
+	return &session, nil
+}
+
+func sendNewDeviceEmail(email string, locale string, session models.Session) {
+	if err := emails.SendNewDeviceEmail(email, locale, session.Device, session.IP, session.CreatedAt); err != nil {
+		fmt.Printf("could not send new device email: %v \n", err)
+	}
+}
+
+// Touch rejects revoked sessions and records when an active one was last used
+func Touch(ID primitive.ObjectID, userID primitive.ObjectID) error {
+	owner, err := cisredis.Retrieve(activeKey(ID))
+	if err != nil {
+		if err != redis.Nil {
+			return err
+		}
+		// the marker may have expired, fall back to the database
+		session, err := getSession(userID, ID)
+		if err != nil || !session.IsActive() {
+			return ErrSessionRevoked
+		}
+		owner = userID.Hex()
+		if err := cisredis.Store(activeKey(ID), owner, cacheTTL); err != nil {
+			return err
+		}
+	}
+	if owner != userID.Hex() {
+		return ErrSessionRevoked
+	}
+
+	return cisredis.Store(lastSeenKey(ID), time.Now().UTC().Format(time.RFC3339), cacheTTL)
+}
+
+func getSession(userID primitive.ObjectID, ID primitive.ObjectID) (*models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var session models.Session
+	err := sessionCollection.FindOne(ctx, bson.M{"_id": ID, "user_id": userID}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no session found with ID %s", ID.Hex())
+		}
+		return nil, fmt.Errorf("failed to fetch session: %v", err)
+	}
+	return &session, nil
+}
+
+// List returns the user's active sessions, most recent first
+func List(userID primitive.ObjectID) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := sessionCollection.Find(ctx, bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := make([]models.Session, 0)
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %v", err)
+	}
+
+	for i := range sessions {
+		lastSeen, err := cisredis.Retrieve(lastSeenKey(sessions[i].ID))
+		if err != nil {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339, lastSeen); err == nil {
+			sessions[i].LastSeenAt = at
+		}
+	}
+	return sessions, nil
+}
+
+// Revoke signs a session out; tokens issued for it stop working immediately
+func Revoke(userID primitive.ObjectID, ID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	result, err := sessionCollection.UpdateOne(ctx,
+		bson.M{"_id": objID, "user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("could not revoke session: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no active session found with ID %s", ID)
+	}
+
+	if err := cisredis.Delete(activeKey(objID)); err != nil {
+		return err
+	}
+	return cisredis.Delete(lastSeenKey(objID))
+}
+
+// RevokeAll signs the user out everywhere, e.g. after their credentials changed
+func RevokeAll(userID primitive.ObjectID) error {
+	return RevokeOthers(userID, primitive.NilObjectID)
+}
+
+// RevokeOthers signs the user out everywhere but the session keep, e.g. the one they changed their password from
+func RevokeOthers(userID primitive.ObjectID, keep primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}}
+	if !keep.IsZero() {
+		filter["_id"] = bson.M{"$ne": keep}
+	}
+	cursor, err := sessionCollection.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to find sessions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	active := make([]models.Session, 0)
+	if err := cursor.All(ctx, &active); err != nil {
+		return fmt.Errorf("failed to decode sessions: %v", err)
+	}
+
+	_, err = sessionCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("could not revoke sessions: %v", err)
+	}
+	return Forget(active)
+}
+
+// DeleteAll removes every session of a user, e.g. when the account is deleted;
+// ctx is the transaction the deletion is part of. The deleted sessions are returned
+// so their cached state can be dropped with Forget once the transaction has committed
+func DeleteAll(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	filter := bson.M{"user_id": userID}
+	cursor, err := sessionCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	all := make([]models.Session, 0)
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %w", err)
+	}
+
+	_, err = sessionCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("could not delete sessions: %w", err)
+	}
+	return all, nil
+}
+
+// Forget drops the cached state of sessions that are no longer valid
+func Forget(sessions []models.Session) error {
+	for _, session := range sessions {
+		if err := cisredis.Delete(activeKey(session.ID)); err != nil {
+			return err
+		}
+		if err := cisredis.Delete(lastSeenKey(session.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package sessions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+)
+
+func TestDescribeDevice(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36":               "Chrome on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/604.1": "Safari on iPhone",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0":                                                    "Firefox on Linux",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Edg/120.0":     "Edge on Windows",
+		"curl/8.4.0": "Unknown device",
+	}
+
+	for userAgent, expected := range tests {
+		assert.Equal(t, expected, describeDevice(userAgent))
+	}
+}
+
+func TestRevokeOthers(t *testing.T) {
+	user := &models.User{Id: primitive.NewObjectID(), Email: "fan@example.com"}
+	current, err := Create(user, "curl/8.4.0", "127.0.0.1")
+	assert.NoError(t, err)
+	other, err := Create(user, "curl/8.4.0", "127.0.0.2")
+	assert.NoError(t, err)
+
+	// the session the password was changed from stays signed in
+	assert.NoError(t, RevokeOthers(user.Id, current.ID))
+	assert.NoError(t, Touch(current.ID, user.Id))
+	assert.Equal(t, ErrSessionRevoked, Touch(other.ID, user.Id))
+
+	assert.NoError(t, RevokeAll(user.Id))
+	assert.Equal(t, ErrSessionRevoked, Touch(current.ID, user.Id))
+}
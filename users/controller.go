@@ -1,12 +1,19 @@
 package users
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"league/helpers"
+	"league/jwt"
 	"league/models"
+	"league/passwords"
+	"league/roles"
+	"league/sessions"
 
 	"net/http"
 )
@@ -80,6 +87,18 @@ func updateUserHandler(ctx *gin.Context) {
 		return
 	}
 
+	changingEmail := req.Email != "" && !strings.EqualFold(req.Email, user.Email)
+
+	// the email is a sign in credential, so it stays out of reach while impersonating
+	if changingEmail && user.IsImpersonated() {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    models.ErrImpersonating.Error(),
+			StatusCode: http.StatusForbidden,
+			Data:       nil,
+		})
+		return
+	}
+
 	id := user.Id.Hex()
 	updatedUser, err := updateUser(id, req)
 	if err != nil {
@@ -90,8 +109,22 @@ func updateUserHandler(ctx *gin.Context) {
 		})
 		return
 	}
+
+	message := "successfully updated user"
+	if changingEmail {
+		if err := requestEmailChange(user, req.Email); err != nil {
+			helpers.CreateResponse(ctx, helpers.Response{
+				Message:    err.Error(),
+				StatusCode: http.StatusBadRequest,
+				Data:       nil,
+			})
+			return
+		}
+		message = "successfully updated user, confirm your new email address to finish changing it"
+	}
+
 	helpers.CreateResponse(ctx, helpers.Response{
-		Message:    "successfully updated user",
+		Message:    message,
 		StatusCode: http.StatusOK,
 		Data:       updatedUser,
 	})
@@ -108,8 +141,226 @@ func deleteUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	fmt.Println(user)
-	err = deleteUser(user.Id)
+	// the account is anonymised after a grace period during which it can still be cancelled
+	at, err := scheduleErasure(user)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully scheduled account deletion",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"erasure_scheduled_for": at,
+		},
+	})
+}
+
+func cancelErasureHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := cancelErasure(user.Id); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully cancelled account deletion",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
+
+func exportUserHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	archive, err := exportUser(user.Id)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"league-export-%s.json\"", user.Id.Hex()))
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully exported user data",
+		StatusCode: http.StatusOK,
+		Data:       archive,
+	})
+}
+
+func changeRoleHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	var req RoleChangeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	updatedUser, err := changeRole(user, models.AuditActorFromContext(ctx), ctx.Param("id"), models.Role(req.Role))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully changed user role",
+		StatusCode: http.StatusOK,
+		Data:       updatedUser,
+	})
+}
+
+func getRolesHandler(ctx *gin.Context) {
+	result, err := roles.GetRoles()
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched roles",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":        result,
+			"permissions": models.Permissions,
+		},
+	})
+}
+
+func createRoleHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	var req RoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	role, err := roles.CreateRole(models.AuditActorFromContext(ctx), user.RoleName, models.Role(req.Name), req.Description, req.Permissions)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: roleStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully created role",
+		StatusCode: http.StatusOK,
+		Data:       role,
+	})
+}
+
+func updateRoleHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	var req RolePermissionsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	role, err := roles.UpdateRole(models.AuditActorFromContext(ctx), user.RoleName, models.Role(ctx.Param("name")), req.Description, req.Permissions)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: roleStatus(err),
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully updated role",
+		StatusCode: http.StatusOK,
+		Data:       role,
+	})
+}
+
+func roleStatus(err error) int {
+	if errors.Is(err, models.ErrPrivilegedPermission) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func deleteRoleHandler(ctx *gin.Context) {
+	err := roles.DeleteRole(models.AuditActorFromContext(ctx), models.Role(ctx.Param("name")))
 	if err != nil {
 		helpers.CreateResponse(ctx, helpers.Response{
 			Message:    err.Error(),
@@ -119,10 +370,384 @@ func deleteUserHandler(ctx *gin.Context) {
 		return
 	}
 
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully deleted role",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
+
+func setClubsHandler(ctx *gin.Context) {
+	var req ClubsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	user, err := setClubs(models.AuditActorFromContext(ctx), ctx.Param("id"), req.Clubs)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully updated user clubs",
+		StatusCode: http.StatusOK,
+		Data:       user,
+	})
+}
+
+func getSessionsHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	userSessions, err := sessions.List(user.Id)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	current := ctx.GetString("session_id")
+	for i := range userSessions {
+		userSessions[i].Current = userSessions[i].ID.Hex() == current
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched sessions",
+		StatusCode: http.StatusOK,
+		Data:       userSessions,
+	})
+}
+
+func revokeSessionHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := sessions.Revoke(user.Id, ctx.Param("id")); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully signed out session",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
+
+func changePasswordHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := passwords.Verify(user.Id, req.CurrentPassword); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusUnauthorized,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := passwords.Set(user.Id, req.NewPassword); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	// whoever else knew the old password is signed out, the session the change was made from stays
+	current, _ := primitive.ObjectIDFromHex(ctx.GetString("session_id"))
+	if err := sessions.RevokeOthers(user.Id, current); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "Successfully changed password",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
+
+func confirmEmailChangeHandler(ctx *gin.Context) {
+	user, err := confirmEmailChange(ctx.Query("token"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully changed email, please sign in again",
+		StatusCode: http.StatusOK,
+		Data:       user,
+	})
+}
+
+func impersonateHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	session, _ := primitive.ObjectIDFromHex(ctx.GetString("session_id"))
+	token, target, err := impersonate(user, models.AuditActorFromContext(ctx), session, ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully started impersonation",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"token":      token,
+			"user":       target,
+			"expires_in": int(jwt.ImpersonationTTL.Seconds()),
+		},
+	})
+}
+
+func getUserByIDHandler(ctx *gin.Context) {
+	user, err := getUserByID(ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusNotFound,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched user",
+		StatusCode: http.StatusOK,
+		Data:       user,
+	})
+}
+
+func suspendUserHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	var req SuspendRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && ctx.Request.ContentLength > 0 {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	suspended, err := setSuspended(user, models.AuditActorFromContext(ctx), ctx.Param("id"), true, req.Reason)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully suspended user",
+		StatusCode: http.StatusOK,
+		Data:       suspended,
+	})
+}
+
+func unsuspendUserHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	reinstated, err := setSuspended(user, models.AuditActorFromContext(ctx), ctx.Param("id"), false, "")
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully unsuspended user",
+		StatusCode: http.StatusOK,
+		Data:       reinstated,
+	})
+}
+
+func forcePasswordResetHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := forcePasswordReset(user, models.AuditActorFromContext(ctx), ctx.Param("id")); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully required a password reset",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
+
+func adminDeleteUserHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	if err := adminDeleteUser(user, models.AuditActorFromContext(ctx), ctx.Param("id")); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
 	helpers.CreateResponse(ctx, helpers.Response{
 		Message:    "successfully deleted user",
 		StatusCode: http.StatusOK,
 		Data:       nil,
 	})
+}
 
+func getUserTrashHandler(ctx *gin.Context) {
+	users, total, page, perPage, err := getTrash(ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched deleted users",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     users,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func undeleteUserHandler(ctx *gin.Context) {
+	user, err := undeleteUser(models.AuditActorFromContext(ctx), ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully restored user",
+		StatusCode: http.StatusOK,
+		Data:       user,
+	})
 }
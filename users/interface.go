@@ -1,7 +1,45 @@
 package users
 
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+)
+
 type UserRequest struct {
 	FirstName string `json:"first_name" binding:"required,min=3"`
 	LastName  string `json:"last_name" binding:"required,min=3"`
-	Email     string `json:"email" binding:"required,email"`
+	// Email changes only apply once the new address is confirmed
+	Email string `json:"email" binding:"omitempty,email"`
+	// Locale picks the language of emails; empty keeps the current one
+	Locale string `json:"locale" binding:"omitempty,max=16"`
+}
+
+type RoleChangeRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type RoleRequest struct {
+	Name        string              `json:"name" binding:"required,min=3,max=32"`
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions" binding:"required"`
+}
+
+type RolePermissionsRequest struct {
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions" binding:"required"`
+}
+
+type ClubsRequest struct {
+	Clubs []primitive.ObjectID `json:"clubs" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	// CurrentPassword may be left out by accounts that never had a password
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type SuspendRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
 }
@@ -9,12 +9,35 @@ import (
 )
 
 func UserRoutes(superRoute *gin.RouterGroup) {
+	// opened from the confirmation email, possibly on a device that is not signed in
+	superRoute.GET("/users/email/confirm", confirmEmailChangeHandler)
+
 	userRouter := superRoute.Group("/users")
 	{
 		userRouter.Use(jwt.Middleware())
-		userRouter.GET("/", middleware.RolesMiddleware([]models.Role{models.AdminRole, models.SuperAdminRole}), getUsersHandler)
+		userRouter.GET("/", middleware.RequirePermission(models.UsersRead), getUsersHandler)
 		userRouter.GET("/user", getUserHandler)
 		userRouter.PATCH("/user", updateUserHandler)
-		userRouter.DELETE("/user", deleteUserHandler)
+		userRouter.DELETE("/user", jwt.NotImpersonating(), deleteUserHandler)
+		userRouter.DELETE("/user/erasure", jwt.NotImpersonating(), cancelErasureHandler)
+		userRouter.GET("/user/export", jwt.NotImpersonating(), exportUserHandler)
+		userRouter.POST("/user/password", jwt.NotImpersonating(), changePasswordHandler)
+		userRouter.GET("/user/sessions", getSessionsHandler)
+		userRouter.DELETE("/user/sessions/:id", jwt.NotImpersonating(), revokeSessionHandler)
+		userRouter.GET("/:id", middleware.RequirePermission(models.UsersRead), getUserByIDHandler)
+		userRouter.DELETE("/:id", middleware.RequirePermission(models.UsersWrite), adminDeleteUserHandler)
+		userRouter.GET("/trash", middleware.RequirePermission(models.UsersWrite), getUserTrashHandler)
+		userRouter.POST("/:id/restore", middleware.RequirePermission(models.UsersWrite), undeleteUserHandler)
+		userRouter.POST("/:id/suspend", middleware.RequirePermission(models.UsersWrite), suspendUserHandler)
+		userRouter.POST("/:id/unsuspend", middleware.RequirePermission(models.UsersWrite), unsuspendUserHandler)
+		userRouter.POST("/:id/password-reset", middleware.RequirePermission(models.UsersWrite), forcePasswordResetHandler)
+		userRouter.PATCH("/:id/role", middleware.RolesMiddleware([]models.Role{models.SuperAdminRole}), changeRoleHandler)
+		userRouter.PUT("/:id/clubs", middleware.RequirePermission(models.UsersWrite), setClubsHandler)
+		userRouter.POST("/:id/impersonate", middleware.RolesMiddleware([]models.Role{models.SuperAdminRole}), impersonateHandler)
+
+		userRouter.GET("/roles", middleware.RequirePermission(models.RolesWrite), getRolesHandler)
+		userRouter.POST("/roles", middleware.RequirePermission(models.RolesWrite), createRoleHandler)
+		userRouter.PATCH("/roles/:name", middleware.RequirePermission(models.RolesWrite), updateRoleHandler)
+		userRouter.DELETE("/roles/:name", middleware.RequirePermission(models.RolesWrite), deleteRoleHandler)
 	}
 }
@@ -6,12 +6,22 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"league/apikeys"
 	"league/db"
+	"league/emails"
+	"league/events"
+	"league/integrity"
+	"league/jwt"
 	"league/models"
 	"league/redis"
+	"league/roles"
+	"league/sessions"
 
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +30,21 @@ import (
 var userCollection *mongo.Collection = db.GetCollection(db.MongoClient, "users")
 // var userCollection *mongo.Collection //for tests
 var duration time.Duration = 10 * time.Second
+var appURL string
+
+// how long an erasure request can still be cancelled
+var erasureGracePeriod time.Duration = 14 * 24 * time.Hour
+
+func init() {
+	appURL = os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:8000"
+	}
+
+	if days, err := strconv.Atoi(os.Getenv("ERASURE_GRACE_DAYS")); err == nil {
+		erasureGracePeriod = time.Duration(days) * 24 * time.Hour
+	}
+}
 
 func updateUser(ID string, update UserRequest) (*models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
@@ -31,24 +56,19 @@ func updateUser(ID string, update UserRequest) (*models.User, error) {
 		return nil, fmt.Errorf("invalid ObjectID: %v", err)
 	}
 
-	// Create update fields
+	// Create update fields, the email goes through requestEmailChange instead
 	updates := bson.M{
 		"first_name": update.FirstName,
 		"last_name":  update.LastName,
-		"email":      strings.ToLower(update.Email),
+		"updated_at": time.Now(),
+	}
+	if update.Locale != "" {
+		updates["locale"] = update.Locale
 	}
 
 	// Perform the update operation
-	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": updates})
+	_, err = userCollection.UpdateOne(ctx, db.NotDeleted(bson.M{"_id": objID}), bson.M{"$set": updates})
 	if err != nil {
-		// Handle specific error types
-		if mongoErr, ok := err.(mongo.WriteException); ok {
-			for _, e := range mongoErr.WriteErrors {
-				if e.Code == 11000 {
-					return nil, fmt.Errorf("email already exists: %s", update.Email)
-				}
-			}
-		}
 		return nil, fmt.Errorf("could not update user: %v", err)
 	}
 
@@ -59,21 +79,12 @@ func updateUser(ID string, update UserRequest) (*models.User, error) {
 		return nil, fmt.Errorf("failed to fetch updated user: %v", err)
 	}
 
-	// Update user data in Redis
-	userByte, err := redis.StoreStruct(user)
-	if err != nil {
-		return nil, fmt.Errorf("failed to store user data in Redis: %v", err)
-	}
-	expiration := 10 * time.Minute
-	err = redis.Store(objID.Hex(), userByte, expiration)
-	if err != nil {
-		return nil, fmt.Errorf("failed to store user data in Redis with expiration: %v", err)
-	}
+	events.PublishCommitted(events.UserUpdated{User: user})
 
 	return &user, nil
 }
 
-func deleteUser(ID primitive.ObjectID) error {
+func deleteUser(by models.AuditActor, ID primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
 	defer cancel()
 
@@ -82,24 +93,61 @@ func deleteUser(ID primitive.ObjectID) error {
 	// 	return fmt.Errorf("invalid ObjectID: %v", err)
 	// }
 
-	result, err := userCollection.DeleteOne(ctx, bson.M{"_id": ID})
-	if err != nil {
-		return fmt.Errorf("failed to delete user: %v", err)
-	}
+	var credentials deletedCredentials
+	err := db.Transaction(ctx, func(ctx context.Context) error {
+		// the account goes to the trash until it is restored or purged
+		result, err := userCollection.UpdateOne(ctx, db.NotDeleted(bson.M{"_id": ID}), bson.M{"$set": bson.M{"deleted_at": time.Now()}})
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
 
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("no user found with ID %s", ID)
-	}
+		if result.MatchedCount == 0 {
+			return fmt.Errorf("no user found with ID %s", ID)
+		}
 
-	// Delete user data from Redis
-	err = redis.Delete(ID.Hex())
+		// Clean up everything that authenticates as the user
+		if credentials, err = deleteCredentials(ctx, ID); err != nil {
+			return err
+		}
+		return events.PublishInTransaction(ctx, events.UserDeleted{Actor: by, UserID: ID})
+	})
 	if err != nil {
 		return err
 	}
+	credentials.forget()
 
+	events.PublishCommitted(events.UserDeleted{Actor: by, UserID: ID})
 	return nil
 }
 
+// deletedCredentials are the sessions and api keys removed with an account, their cached state is dropped after commit
+type deletedCredentials struct {
+	sessions []models.Session
+	keys     []models.APIKey
+}
+
+// deleteCredentials removes every session and api key of a user; only MongoDB is written so it can run in a transaction
+func deleteCredentials(ctx context.Context, ID primitive.ObjectID) (deletedCredentials, error) {
+	var credentials deletedCredentials
+	var err error
+	if credentials.sessions, err = sessions.DeleteAll(ctx, ID); err != nil {
+		return credentials, err
+	}
+	credentials.keys, err = apikeys.DeleteForUser(ctx, ID)
+	return credentials, err
+}
+
+// forget drops the cached state of committed deletions; the account is already gone,
+// so a Redis failure is logged rather than reported as a failed deletion
+func (c deletedCredentials) forget() {
+	if err := sessions.Forget(c.sessions); err != nil {
+		fmt.Printf("could not forget deleted sessions: %v \n", err)
+	}
+	if err := apikeys.ForgetUsage(c.keys); err != nil {
+		fmt.Printf("could not forget deleted api keys: %v \n", err)
+	}
+}
+
 func getUsers(filters UserRequest, pageNumber string, pageSize string) ([]models.User, int64, int64, int64, error) {
 	perPage := int64(15)
 	page := int64(1)
@@ -118,7 +166,7 @@ func getUsers(filters UserRequest, pageNumber string, pageSize string) ([]models
 
 	offset := (page - 1) * perPage
 
-	filter := bson.M{}
+	filter := db.NotDeleted(bson.M{})
 
 	if filters.Email != "" {
 		filter["email"] = filters.Email
@@ -154,3 +202,581 @@ func getUsers(filters UserRequest, pageNumber string, pageSize string) ([]models
 
 	return users, total, page, perPage, nil
 }
+
+func changeRole(actor *models.User, by models.AuditActor, ID string, role models.Role) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+	if objID == actor.Id {
+		return nil, fmt.Errorf("you cannot change your own role")
+	}
+
+	if _, err := roles.GetRole(role); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = userCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": objID})).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no user found with ID %s", ID)
+		}
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	// only super-admins may promote to or demote from super-admin
+	if (role == models.SuperAdminRole || user.RoleName == models.SuperAdminRole) && actor.RoleName != models.SuperAdminRole {
+		return nil, fmt.Errorf("only a super-admin can change super-admin roles")
+	}
+
+	before := user
+	user.RoleName = role
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		_, err := userCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}})
+		if err != nil {
+			return fmt.Errorf("could not update user: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.UserRoleChanged{Actor: by, Before: before, After: user})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// subscribers refresh the cached copy so jwt.GetUser picks up the new role
+	events.PublishCommitted(events.UserRoleChanged{Actor: by, Before: before, After: user})
+	return &user, nil
+}
+
+// setClubs replaces the teams a user administers as a club admin
+func setClubs(by models.AuditActor, ID string, clubs []primitive.ObjectID) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	// the clubs cannot be deleted between the check and the update
+	var before, user models.User
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		if err := integrity.Require(ctx, "teams", clubs...); err != nil {
+			return err
+		}
+		err := userCollection.FindOneAndUpdate(ctx, db.NotDeleted(bson.M{"_id": objID}), bson.M{"$set": bson.M{"clubs": clubs, "updated_at": time.Now()}}).Decode(&before)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("no user found with ID %s", ID)
+			}
+			return fmt.Errorf("could not update user: %w", err)
+		}
+		err = userCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+		if err != nil {
+			return fmt.Errorf("failed to fetch updated user: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.UserClubsChanged{Actor: by, Before: before, After: user})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events.PublishCommitted(events.UserClubsChanged{Actor: by, Before: before, After: user})
+	return &user, nil
+}
+
+const emailChangePurpose = "email-change"
+
+var emailChangeTTL time.Duration = 24 * time.Hour
+
+type emailChange struct {
+	UserID primitive.ObjectID `json:"user_id"`
+	Email  string             `json:"email"`
+}
+
+func emailChangeKey(jti string) string {
+	return "email-change:" + jti
+}
+
+// requestEmailChange mails a confirmation link to the new address and a notice to the current one
+func requestEmailChange(user *models.User, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	email = strings.ToLower(email)
+	count, err := userCollection.CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		return fmt.Errorf("failed to check email: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("email already exists: %s", email)
+	}
+
+	token, jti, err := jwt.GenerateLinkToken(user.Id, emailChangePurpose, emailChangeTTL)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(emailChange{UserID: user.Id, Email: email})
+	if err != nil {
+		return err
+	}
+	if err := redis.Store(emailChangeKey(jti), value, emailChangeTTL); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/confirm-email?token=%s", strings.TrimRight(appURL, "/"), token)
+	sendEmailChangeEmails(user.Email, email, user.Locale, link)
+	return nil
+}
+
+func sendEmailChangeEmails(oldEmail string, newEmail string, locale string, link string) {
+	if err := emails.SendConfirmEmailChangeEmail(newEmail, locale, link); err != nil {
+		fmt.Printf("could not send email change confirmation: %v \n", err)
+	}
+	if err := emails.SendEmailChangeNoticeEmail(oldEmail, locale, newEmail); err != nil {
+		fmt.Printf("could not send email change notice: %v \n", err)
+	}
+}
+
+// confirmEmailChange applies a confirmed change and signs the user out everywhere
+func confirmEmailChange(token string) (*models.User, error) {
+	ID, jti, err := jwt.ParseLinkToken(token, emailChangePurpose)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := redis.Retrieve(emailChangeKey(jti))
+	if err != nil {
+		return nil, errors.New("this link has already been used or has expired")
+	}
+	unused, err := redis.Consume(emailChangeKey(jti))
+	if err != nil {
+		return nil, err
+	}
+	if !unused {
+		return nil, errors.New("this link has already been used or has expired")
+	}
+
+	var change emailChange
+	if err := json.Unmarshal([]byte(value), &change); err != nil {
+		return nil, fmt.Errorf("failed to decode email change: %v", err)
+	}
+	if change.UserID != ID {
+		return nil, errors.New("invalid link")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	_, err = userCollection.UpdateOne(ctx,
+		bson.M{"_id": ID},
+		bson.M{"$set": bson.M{"email": change.Email, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		if mongoErr, ok := err.(mongo.WriteException); ok {
+			for _, e := range mongoErr.WriteErrors {
+				if e.Code == 11000 {
+					return nil, fmt.Errorf("email already exists: %s", change.Email)
+				}
+			}
+		}
+		return nil, fmt.Errorf("could not update user: %v", err)
+	}
+
+	if err := sessions.RevokeAll(ID); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": ID}).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to fetch updated user: %v", err)
+	}
+	events.PublishCommitted(events.UserUpdated{User: user})
+	return &user, nil
+}
+
+// impersonate issues a short lived token that lets a super-admin see the app as the target user
+func impersonate(actor *models.User, by models.AuditActor, sessionID primitive.ObjectID, ID string) (string, *models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+	if objID == actor.Id {
+		return "", nil, errors.New("you cannot impersonate yourself")
+	}
+
+	var target models.User
+	if err := userCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": objID})).Decode(&target); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", nil, fmt.Errorf("no user found with ID %s", ID)
+		}
+		return "", nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	if target.RoleName == models.SuperAdminRole {
+		return "", nil, errors.New("super admins cannot be impersonated")
+	}
+
+	token, err := jwt.GenerateImpersonationJWT(target.Id, actor.Id, sessionID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// the audit entry is the only write, without it the token is not handed out
+	err = events.PublishInTransaction(ctx, events.ImpersonationStarted{Actor: by, Target: target})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &target, nil
+}
+
+func getUserByID(ID string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	var user models.User
+	err = userCollection.FindOne(ctx, db.NotDeleted(bson.M{"_id": objID})).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no user found with ID %s", ID)
+		}
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	return &user, nil
+}
+
+// manageableUser loads a user the actor is allowed to act on: never themselves, and super-admins only by super-admins
+func manageableUser(actor *models.User, ID string) (*models.User, error) {
+	user, err := getUserByID(ID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Id == actor.Id {
+		return nil, errors.New("you cannot perform this action on your own account")
+	}
+	if user.RoleName == models.SuperAdminRole && actor.RoleName != models.SuperAdminRole {
+		return nil, errors.New("only a super-admin can manage a super-admin")
+	}
+	return user, nil
+}
+
+// setSuspended suspends or reinstates an account; suspending signs the user out everywhere
+func setSuspended(actor *models.User, by models.AuditActor, ID string, suspend bool, reason string) (*models.User, error) {
+	user, err := manageableUser(actor, ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	update := bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"suspended_at": "", "suspended_reason": ""},
+	}
+	if suspend {
+		update = bson.M{"$set": bson.M{"suspended_at": time.Now(), "suspended_reason": reason, "updated_at": time.Now()}}
+	}
+	var updated models.User
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		err := userCollection.FindOneAndUpdate(ctx, bson.M{"_id": user.Id}, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+		if err != nil {
+			return fmt.Errorf("could not update user: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.UserSuspended{Actor: by, Before: *user, After: updated, Suspended: suspend})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if suspend {
+		if err := sessions.RevokeAll(user.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	// subscribers drop the cached copy so jwt.GetUser sees the new status
+	events.PublishCommitted(events.UserSuspended{Actor: by, Before: *user, After: updated, Suspended: suspend})
+	return &updated, nil
+}
+
+// forcePasswordReset blocks sign in until the user resets their password through the forgot password flow
+func forcePasswordReset(actor *models.User, by models.AuditActor, ID string) error {
+	user, err := manageableUser(actor, ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		_, err := userCollection.UpdateOne(ctx,
+			bson.M{"_id": user.Id},
+			bson.M{"$set": bson.M{"password_reset_required": true, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return fmt.Errorf("could not update user: %w", err)
+		}
+		return events.PublishInTransaction(ctx, events.PasswordResetForced{Actor: by, User: *user})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := sessions.RevokeAll(user.Id); err != nil {
+		return err
+	}
+	events.PublishCommitted(events.PasswordResetForced{Actor: by, User: *user})
+	return nil
+}
+
+// adminDeleteUser deletes another user's account together with their sessions, api keys and cached data
+func adminDeleteUser(actor *models.User, by models.AuditActor, ID string) error {
+	user, err := manageableUser(actor, ID)
+	if err != nil {
+		return err
+	}
+	return deleteUser(by, user.Id)
+}
+
+// reference is a field in another collection that holds a user ID
+type reference struct {
+	Collection string
+	Field      string
+	// ByEmail is set when the field holds the user's address instead of their ID
+	ByEmail bool
+	// Erase deletes the documents on erasure because they only exist for the user;
+	// the others are league records that keep pointing at the anonymised account
+	Erase bool
+	// Hidden fields are left out of exports on top of exportProjection because they describe other people
+	Hidden []string
+}
+
+// userReferences lists every place a user is stored; exports read them and erasure removes or keeps them valid
+var userReferences = []reference{
+	{Collection: "teams", Field: "created_by"},
+	{Collection: "invites", Field: "invited_by"},
+	{Collection: "api_keys", Field: "user_id"},
+	{Collection: "sessions", Field: "user_id"},
+	// what an admin did is theirs, the before and after of the people they did it to are not
+	{Collection: "audit_log", Field: "actor_id", Hidden: []string{"changes"}},
+	{Collection: "audit_log", Field: "impersonated_id", Hidden: []string{"changes"}},
+	{Collection: "webhooks", Field: "created_by"},
+	{Collection: "fixture_revisions", Field: "editor_id"},
+	{Collection: "fixture_revisions", Field: "impersonated_id"},
+	{Collection: "notification_preferences", Field: "user_id", Erase: true},
+	{Collection: "notifications", Field: "user_id", Erase: true},
+	{Collection: "email_outbox", Field: "to", ByEmail: true, Erase: true},
+}
+
+// secrets are never part of an export, even hashed; email bodies are left out because they carry sign in codes and links
+var exportProjection = bson.M{
+	"password":           0,
+	"password_history":   0,
+	"verification_token": 0,
+	"key_hash":           0,
+	"token_hash":         0,
+	"secret":             0,
+	"unsubscribe_token":  0,
+	"html":               0,
+	"text":               0,
+	"headers":            0,
+}
+
+// projection is what an export of the reference leaves out
+func (ref reference) projection() bson.M {
+	projection := bson.M{}
+	for field, value := range exportProjection {
+		projection[field] = value
+	}
+	for _, field := range ref.Hidden {
+		projection[field] = 0
+	}
+	return projection
+}
+
+// filter matches the documents of a reference that belong to the user
+func (ref reference) filter(user *models.User) bson.M {
+	if ref.ByEmail {
+		return bson.M{ref.Field: user.Email}
+	}
+	return bson.M{ref.Field: user.Id}
+}
+
+// exportUser gathers the user's profile and every document that references them
+func exportUser(ID primitive.ObjectID) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": ID}).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	var profile bson.M
+	err := userCollection.FindOne(ctx, bson.M{"_id": ID}, options.FindOne().SetProjection(exportProjection)).Decode(&profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	archive := map[string]interface{}{
+		"exported_at": time.Now(),
+		"profile":     profile,
+	}
+	for _, ref := range userReferences {
+		collection := db.GetCollection(db.MongoClient, ref.Collection)
+		cursor, err := collection.Find(ctx, ref.filter(&user), options.Find().SetProjection(ref.projection()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %v: %v", ref.Collection, err)
+		}
+		documents := make([]bson.M, 0)
+		if err := cursor.All(ctx, &documents); err != nil {
+			return nil, fmt.Errorf("failed to decode %v: %v", ref.Collection, err)
+		}
+
+		key := ref.Collection
+		if existing, ok := archive[key].([]bson.M); ok {
+			documents = append(existing, documents...)
+		}
+		archive[key] = documents
+	}
+	return archive, nil
+}
+
+// scheduleErasure marks the account for anonymisation once the grace period is over
+func scheduleErasure(user *models.User) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	at := time.Now().Add(erasureGracePeriod)
+	_, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": user.Id},
+		bson.M{"$set": bson.M{"erasure_scheduled_for": at, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not schedule erasure: %v", err)
+	}
+	events.PublishCommitted(events.ErasureScheduled{User: *user, At: at})
+	return at, nil
+}
+
+func cancelErasure(ID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": ID, "erasure_scheduled_for": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"erasure_scheduled_for": ""}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("could not cancel erasure: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("your account is not scheduled for deletion")
+	}
+	events.PublishCommitted(events.ErasureCancelled{UserID: ID})
+	return nil
+}
+
+// eraseUser anonymises the account in place so documents referencing its ID stay valid,
+// and deletes the documents that only exist for the user
+func eraseUser(ID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var credentials deletedCredentials
+	err := db.Transaction(ctx, func(ctx context.Context) error {
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"_id": ID}).Decode(&user); err != nil {
+			return fmt.Errorf("failed to fetch user: %w", err)
+		}
+		for _, ref := range userReferences {
+			if !ref.Erase {
+				continue
+			}
+			_, err := db.GetCollection(db.MongoClient, ref.Collection).DeleteMany(ctx, ref.filter(&user))
+			if err != nil {
+				return fmt.Errorf("could not erase %v: %w", ref.Collection, err)
+			}
+		}
+
+		_, err := userCollection.UpdateOne(ctx, bson.M{"_id": ID}, bson.M{
+			"$set": bson.M{
+				"first_name": "Deleted",
+				"last_name":  "User",
+				"email":      fmt.Sprintf("deleted-%s@erased.invalid", ID.Hex()),
+				"erased_at":  time.Now(),
+				"updated_at": time.Now(),
+			},
+			"$unset": bson.M{
+				"password":              "",
+				"password_history":      "",
+				"verification_token":    "",
+				"identities":            "",
+				"clubs":                 "",
+				"suspended_reason":      "",
+				"erasure_scheduled_for": "",
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("could not erase user: %w", err)
+		}
+
+		credentials, err = deleteCredentials(ctx, ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	credentials.forget()
+	events.PublishCommitted(events.UserErased{UserID: ID})
+	return nil
+}
+
+// processErasures anonymises every account whose grace period has run out
+func processErasures() {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	cursor, err := userCollection.Find(ctx, bson.M{
+		"erasure_scheduled_for": bson.M{"$lte": time.Now()},
+		"erased_at":             bson.M{"$exists": false},
+	})
+	if err != nil {
+		fmt.Printf("failed to find scheduled erasures: %v \n", err)
+		return
+	}
+	var due []models.User
+	if err := cursor.All(ctx, &due); err != nil {
+		fmt.Printf("failed to decode scheduled erasures: %v \n", err)
+		return
+	}
+
+	for _, user := range due {
+		if err := eraseUser(user.Id); err != nil {
+			fmt.Printf("could not erase user %v: %v \n", user.Id.Hex(), err)
+		}
+	}
+}
+
+// StartErasureWorker periodically erases accounts whose deletion grace period has ended
+func StartErasureWorker() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			processErasures()
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package users
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/emails"
+	"league/events"
+	"league/models"
+	"league/redis"
+
+	"fmt"
+	"time"
+)
+
+// cacheExpiration matches how long jwt.GetUser keeps a user it loaded itself
+const cacheExpiration = 10 * time.Minute
+
+func init() {
+	// the cache is kept in step before the change is reported back, so the next request sees it
+	events.Subscribe(func(e events.UserUpdated) error { return cacheUser(e.User) })
+	events.Subscribe(func(e events.UserRoleChanged) error { return cacheUser(e.After) })
+	events.Subscribe(func(e events.UserClubsChanged) error { return cacheUser(e.After) })
+	events.Subscribe(func(e events.UserSuspended) error { return dropCachedUser(e.After.Id) })
+	events.Subscribe(func(e events.PasswordResetForced) error { return dropCachedUser(e.User.Id) })
+	events.Subscribe(func(e events.ErasureScheduled) error { return dropCachedUser(e.User.Id) })
+	events.Subscribe(func(e events.ErasureCancelled) error { return dropCachedUser(e.UserID) })
+	events.Subscribe(func(e events.UserErased) error { return dropCachedUser(e.UserID) })
+	events.Subscribe(func(e events.UserDeleted) error { return dropCachedUser(e.UserID) })
+	events.Subscribe(func(e events.UserUndeleted) error { return dropCachedUser(e.User.Id) })
+
+	// a failed email never undoes the change, it is only logged
+	events.SubscribeAsync(func(e events.PasswordResetForced) error {
+		return emails.SendPasswordResetRequiredEmail(e.User.Email, e.User.Locale)
+	})
+	events.SubscribeAsync(func(e events.ErasureScheduled) error {
+		return emails.SendErasureScheduledEmail(e.User.Email, e.User.Locale, e.At)
+	})
+}
+
+func cacheUser(user models.User) error {
+	userByte, err := redis.StoreStruct(user)
+	if err != nil {
+		return fmt.Errorf("failed to store user data in Redis: %v", err)
+	}
+	err = redis.Store(user.Id.Hex(), userByte, cacheExpiration)
+	if err != nil {
+		return fmt.Errorf("failed to store user data in Redis with expiration: %v", err)
+	}
+	return nil
+}
+
+func dropCachedUser(ID primitive.ObjectID) error {
+	return redis.Delete(ID.Hex())
+}
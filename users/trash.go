@@ -0,0 +1,93 @@
+package users
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/events"
+	"league/models"
+
+	"context"
+	"fmt"
+	"time"
+)
+
+// getTrash lists deleted users that can still be restored, most recently deleted first
+func getTrash(pageNumber string, pageSize string) ([]models.User, int64, int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	users := make([]models.User, 0)
+	total, page, perPage, err := db.TrashPage(ctx, userCollection, bson.M{"erased_at": bson.M{"$exists": false}}, pageNumber, pageSize, &users)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+	return users, total, page, perPage, nil
+}
+
+// undeleteUser takes an account back out of the trash
+func undeleteUser(actor models.AuditActor, ID string) (*models.User, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var user models.User
+	err = db.Transaction(ctx, func(ctx context.Context) error {
+		err := userCollection.FindOneAndUpdate(ctx,
+			db.Deleted(bson.M{"_id": objID, "erased_at": bson.M{"$exists": false}}),
+			bson.M{"$unset": bson.M{"deleted_at": ""}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&user)
+		if err != nil {
+			return err
+		}
+		return events.PublishInTransaction(ctx, events.UserUndeleted{Actor: actor, User: user})
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("no deleted user found with ID %s", ID)
+		}
+		return nil, fmt.Errorf("could not restore user: %v", err)
+	}
+
+	events.PublishCommitted(events.UserUndeleted{Actor: actor, User: user})
+	return &user, nil
+}
+
+// purgeTrash erases accounts once they have outlived the retention period; they are anonymised rather than removed
+// so the teams, revisions and audit entries that reference them stay valid, and they can no longer be restored
+func purgeTrash() {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	filter := db.Expired(time.Now())
+	filter["erased_at"] = bson.M{"$exists": false}
+	cursor, err := userCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		fmt.Printf("failed to find expired users: %v \n", err)
+		return
+	}
+	var expired []models.User
+	if err := cursor.All(ctx, &expired); err != nil {
+		fmt.Printf("failed to decode expired users: %v \n", err)
+		return
+	}
+
+	for _, user := range expired {
+		if err := eraseUser(user.Id); err != nil {
+			fmt.Printf("failed to purge user %v: %v \n", user.Id.Hex(), err)
+		}
+	}
+}
+
+// StartPurgeWorker periodically erases accounts that have been in the trash past the retention period
+func StartPurgeWorker() {
+	db.StartPurging(purgeTrash)
+}
@@ -10,6 +10,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/models"
 )
 
 var (
@@ -65,7 +67,8 @@ func TestUpdateUser_Success(t *testing.T) {
 	// Verify that user fields are updated correctly
 	assert.Equal(t, update.FirstName, updatedUser.FirstName)
 	assert.Equal(t, update.LastName, updatedUser.LastName)
-	assert.Equal(t, update.Email, updatedUser.Email)
+	// email changes only apply after the new address is confirmed
+	assert.NotEqual(t, update.Email, updatedUser.Email)
 }
 
 // TestDeleteUser_Success tests the deleteUser function.
@@ -77,7 +80,7 @@ func TestDeleteUser_Success(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Call deleteUser function
-	err = deleteUser(ID)
+	err = deleteUser(models.AuditActor{}, ID)
 	assert.NoError(t, err)
 }
 
@@ -95,3 +98,17 @@ func TestGetUsers_Success(t *testing.T) {
 	assert.NotNil(t, users)
 	assert.Greater(t, total, int64(0))
 }
+
+func TestReferenceProjection(t *testing.T) {
+	// audit entries made by the user are exported without the diffs of the people they changed
+	for _, ref := range userReferences {
+		projection := ref.projection()
+		assert.Equal(t, 0, projection["password"], ref.Collection)
+		if ref.Collection == "audit_log" {
+			assert.Equal(t, 0, projection["changes"], ref.Field)
+		}
+	}
+	// the shared projection is left as it is
+	_, hidden := exportProjection["changes"]
+	assert.False(t, hidden)
+}
@@ -0,0 +1,194 @@
+package webhooks
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"league/helpers"
+	"league/models"
+)
+
+func createHandler(ctx *gin.Context) {
+	user, err := models.GetUserFromContext(ctx)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	var req WebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	hook, err := createWebhook(user, req)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully created webhook, store the secret now as it will not be shown again",
+		StatusCode: http.StatusOK,
+		Data:       hook,
+	})
+}
+
+func getWebhooksHandler(ctx *gin.Context) {
+	hooks, total, page, perPage, err := getWebhooks(ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusInternalServerError,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched webhooks",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     hooks,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func getWebhookHandler(ctx *gin.Context) {
+	hook, err := getWebhook(ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusNotFound,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched webhook",
+		StatusCode: http.StatusOK,
+		Data:       hook,
+	})
+}
+
+func updateHandler(ctx *gin.Context) {
+	var req UpdateWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	hook, err := updateWebhook(ctx.Param("id"), req)
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusBadRequest,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully updated webhook",
+		StatusCode: http.StatusOK,
+		Data:       hook,
+	})
+}
+
+func deleteHandler(ctx *gin.Context) {
+	err := deleteWebhook(ctx.Param("id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusNotFound,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully deleted webhook",
+		StatusCode: http.StatusOK,
+		Data:       nil,
+	})
+}
+
+func getDeliveriesHandler(ctx *gin.Context) {
+	deliveries, total, page, perPage, err := getDeliveries(ctx.Param("id"), ctx.Query("status"), ctx.Query("page"), ctx.Query("per_page"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusNotFound,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched deliveries",
+		StatusCode: http.StatusOK,
+		Data: map[string]interface{}{
+			"data":     deliveries,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+func getDeliveryHandler(ctx *gin.Context) {
+	delivery, err := getDelivery(ctx.Param("id"), ctx.Param("delivery_id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusNotFound,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully fetched delivery",
+		StatusCode: http.StatusOK,
+		Data:       delivery,
+	})
+}
+
+func replayHandler(ctx *gin.Context) {
+	delivery, err := replay(ctx.Param("id"), ctx.Param("delivery_id"))
+	if err != nil {
+		helpers.CreateResponse(ctx, helpers.Response{
+			Message:    err.Error(),
+			StatusCode: http.StatusNotFound,
+			Data:       nil,
+		})
+		return
+	}
+
+	helpers.CreateResponse(ctx, helpers.Response{
+		Message:    "successfully queued delivery for replay",
+		StatusCode: http.StatusOK,
+		Data:       delivery,
+	})
+}
@@ -0,0 +1,22 @@
+package webhooks
+
+import (
+	"league/models"
+)
+
+type WebhookRequest struct {
+	URL    string                `json:"url" binding:"required,url"`
+	Events []models.WebhookEvent `json:"events" binding:"required,min=1"`
+}
+
+type UpdateWebhookRequest struct {
+	URL    string                `json:"url" binding:"omitempty,url"`
+	Events []models.WebhookEvent `json:"events" binding:"omitempty,min=1"`
+	Active *bool                 `json:"active"`
+}
+
+// CreatedWebhook is only returned once, when the webhook is created, because it carries the secret
+type CreatedWebhook struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
@@ -0,0 +1,24 @@
+package webhooks
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"league/jwt"
+	"league/middleware"
+	"league/models"
+)
+
+func WebhookRoutes(superRoute *gin.RouterGroup) {
+	webhookRouter := superRoute.Group("/webhooks")
+	{
+		webhookRouter.Use(jwt.Middleware(), middleware.RequirePermission(models.WebhooksWrite))
+		webhookRouter.POST("/", createHandler)
+		webhookRouter.GET("/", getWebhooksHandler)
+		webhookRouter.GET("/:id", getWebhookHandler)
+		webhookRouter.PATCH("/:id", updateHandler)
+		webhookRouter.DELETE("/:id", deleteHandler)
+		webhookRouter.GET("/:id/deliveries", getDeliveriesHandler)
+		webhookRouter.GET("/:id/deliveries/:delivery_id", getDeliveryHandler)
+		webhookRouter.POST("/:id/deliveries/:delivery_id/replay", replayHandler)
+	}
+}
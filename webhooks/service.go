@@ -0,0 +1,485 @@
+package webhooks
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"league/db"
+	"league/models"
+	"league/worker"
+
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var webhookCollection *mongo.Collection = db.GetCollection(db.MongoClient, "webhooks")
+var deliveryCollection *mongo.Collection = db.GetCollection(db.MongoClient, "webhook_deliveries")
+var duration time.Duration = 10 * time.Second
+
+var (
+	// Workers is how many deliveries are sent at once
+	Workers int = worker.EnvInt("WEBHOOK_WORKERS", 2)
+	// MaxAttempts is how often a delivery is tried before it is marked failed
+	MaxAttempts int = worker.EnvInt("WEBHOOK_MAX_ATTEMPTS", 6)
+	// BaseBackoff doubles after every failed attempt up to MaxBackoff
+	BaseBackoff time.Duration = time.Duration(worker.EnvInt("WEBHOOK_BACKOFF_SECONDS", 30)) * time.Second
+	MaxBackoff  time.Duration = 6 * time.Hour
+	// pollInterval is how long an idle worker waits before looking again
+	pollInterval time.Duration = 2 * time.Second
+	// sendTimeout is how long a delivery stays locked while a worker sends it
+	sendTimeout time.Duration = time.Minute
+)
+
+func init() {
+	//check for webhook index, deliveries are listed per webhook
+	exists, err := db.IsIndexExists(context.Background(), deliveryCollection, "webhook_id")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !exists {
+		err = db.IndexNormalField(*deliveryCollection, "webhook_id", 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+
+	//check for status index, workers look deliveries up by it
+	statusExists, err := db.IsIndexExists(context.Background(), deliveryCollection, "status")
+	if err != nil {
+		fmt.Println("Failed to check index existence:", err)
+		return
+	}
+	if !statusExists {
+		err = db.IndexCompound(*deliveryCollection, bson.M{"status": 1, "next_attempt_at": 1}, 1)
+		if err != nil {
+			fmt.Println("Failed to index:", err)
+			return
+		}
+	}
+}
+
+func validateWebhook(rawURL string, events []models.WebhookEvent) error {
+	if rawURL != "" {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("url must be an absolute http or https url")
+		}
+		// names are checked again when they are resolved for each delivery
+		host := parsed.Hostname()
+		ip := net.ParseIP(host)
+		if !AllowPrivateNetworks && (strings.EqualFold(host, "localhost") || (ip != nil && !isPublic(ip))) {
+			return ErrPrivateAddress
+		}
+	}
+	for _, event := range events {
+		if !models.IsValidWebhookEvent(event) {
+			return fmt.Errorf("%v is not a valid webhook event", event)
+		}
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+func createWebhook(user *models.User, req WebhookRequest) (*CreatedWebhook, error) {
+	if err := validateWebhook(req.URL, req.Events); err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, fmt.Errorf("could not create secret: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	hook := models.Webhook{
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    secret,
+		Active:    true,
+		CreatedBy: user.Id,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	result, err := webhookCollection.InsertOne(ctx, hook)
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook: %v", err)
+	}
+	hook.ID = result.InsertedID.(primitive.ObjectID)
+	return &CreatedWebhook{Webhook: hook, Secret: secret}, nil
+}
+
+func getWebhooks(pageNumber string, pageSize string) ([]models.Webhook, int64, int64, int64, error) {
+	perPage := int64(15)
+	page := int64(1)
+
+	if pageSize != "" {
+		if perPageNum, err := strconv.Atoi(pageSize); err == nil {
+			perPage = int64(perPageNum)
+		}
+	}
+
+	if pageNumber != "" {
+		if num, err := strconv.Atoi(pageNumber); err == nil {
+			page = int64(num)
+		}
+	}
+
+	offset := (page - 1) * perPage
+	filter := bson.M{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	fOpt := options.FindOptions{Limit: &perPage, Skip: &offset, Sort: bson.D{{Key: "created_at", Value: -1}}}
+
+	total, err := webhookCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to count webhooks: %v", err)
+	}
+
+	cursor, err := webhookCollection.Find(ctx, filter, &fOpt)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to find webhooks: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	hooks := make([]models.Webhook, 0)
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to decode webhooks: %v", err)
+	}
+
+	return hooks, total, page, perPage, nil
+}
+
+func getWebhook(ID string) (*models.Webhook, error) {
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var hook models.Webhook
+	if err := webhookCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&hook); err != nil {
+		return nil, fmt.Errorf("webhook not found: %v", err)
+	}
+	return &hook, nil
+}
+
+func updateWebhook(ID string, req UpdateWebhookRequest) (*models.Webhook, error) {
+	if err := validateWebhook(req.URL, req.Events); err != nil {
+		return nil, err
+	}
+	hook, err := getWebhook(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := bson.M{"updated_at": time.Now()}
+	if req.URL != "" {
+		updates["url"] = req.URL
+	}
+	if len(req.Events) > 0 {
+		updates["events"] = req.Events
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var updated models.Webhook
+	err = webhookCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": hook.ID},
+		bson.M{"$set": updates},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, fmt.Errorf("could not update webhook: %v", err)
+	}
+	return &updated, nil
+}
+
+// deleteWebhook removes the subscription along with its delivery log
+func deleteWebhook(ID string) error {
+	hook, err := getWebhook(ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	if _, err := webhookCollection.DeleteOne(ctx, bson.M{"_id": hook.ID}); err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	if _, err := deliveryCollection.DeleteMany(ctx, bson.M{"webhook_id": hook.ID}); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %v", err)
+	}
+	return nil
+}
+
+// payload is the JSON body posted to receivers
+type payload struct {
+	ID        string              `json:"id"`
+	Event     models.WebhookEvent `json:"event"`
+	CreatedAt time.Time           `json:"created_at"`
+	Data      interface{}         `json:"data"`
+}
+
+// Emit queues a delivery of event to every active webhook subscribed to it
+func Emit(event models.WebhookEvent, data interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	cursor, err := webhookCollection.Find(ctx, bson.M{
+		"active": true,
+		"events": bson.M{"$in": []models.WebhookEvent{event, models.AllWebhookEvents}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find webhooks: %v", err)
+	}
+	var hooks []models.Webhook
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return fmt.Errorf("failed to decode webhooks: %v", err)
+	}
+
+	now := time.Now()
+	for _, hook := range hooks {
+		deliveryID := primitive.NewObjectID()
+		body, err := json.Marshal(payload{ID: deliveryID.Hex(), Event: event, CreatedAt: now, Data: data})
+		if err != nil {
+			return fmt.Errorf("could not encode webhook payload: %v", err)
+		}
+		delivery := models.WebhookDelivery{
+			ID:            deliveryID,
+			WebhookID:     hook.ID,
+			Event:         event,
+			Payload:       string(body),
+			Status:        models.DeliveryPending,
+			Attempts:      []models.WebhookAttempt{},
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if _, err := deliveryCollection.InsertOne(ctx, delivery); err != nil {
+			return fmt.Errorf("could not queue webhook delivery: %v", err)
+		}
+	}
+	return nil
+}
+
+// Backoff is how long to wait after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	return worker.Backoff(BaseBackoff, MaxBackoff, attempts)
+}
+
+// claim locks the next due delivery for one worker; stale locks from crashed workers are taken over
+func claim() (*models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"status":          models.DeliveryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"$or": []bson.M{
+			{"locked_until": bson.M{"$exists": false}},
+			{"locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(sendTimeout)}}
+
+	var delivery models.WebhookDelivery
+	found, err := worker.Claim(ctx, deliveryCollection, filter, update, &delivery)
+	if err != nil {
+		return nil, fmt.Errorf("could not claim webhook delivery: %v", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return &delivery, nil
+}
+
+// deliver makes one attempt at a claimed delivery and records the outcome
+func deliver(delivery *models.WebhookDelivery) error {
+	var attempt models.WebhookAttempt
+	hook, hookErr := getWebhook(delivery.WebhookID.Hex())
+	switch {
+	case hookErr != nil:
+		attempt = models.WebhookAttempt{At: time.Now(), Error: hookErr.Error()}
+	case !hook.Active:
+		attempt = models.WebhookAttempt{At: time.Now(), Error: "webhook is inactive"}
+	default:
+		attempt = post(*hook, *delivery)
+	}
+
+	attempts := len(delivery.Attempts) + 1
+	now := time.Now()
+	set := bson.M{"updated_at": now}
+	switch {
+	case attempt.Succeeded():
+		set["status"] = models.DeliverySucceeded
+		set["delivered_at"] = now
+	case attempts >= MaxAttempts || hookErr != nil:
+		set["status"] = models.DeliveryFailed
+	default:
+		set["next_attempt_at"] = now.Add(Backoff(attempts))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	_, updateErr := deliveryCollection.UpdateOne(ctx,
+		bson.M{"_id": delivery.ID},
+		bson.M{"$set": set, "$push": bson.M{"attempts": attempt}, "$unset": bson.M{"locked_until": ""}},
+	)
+	if updateErr != nil {
+		return fmt.Errorf("could not update webhook delivery: %v", updateErr)
+	}
+	if !attempt.Succeeded() {
+		return fmt.Errorf("%v", attempt.Error)
+	}
+	return nil
+}
+
+// work sends the next due delivery, it reports false when there was none
+func work() bool {
+	delivery, err := claim()
+	if err != nil {
+		fmt.Println(err)
+	}
+	if delivery == nil {
+		return false
+	}
+	if err := deliver(delivery); err != nil {
+		fmt.Printf("could not deliver webhook %v (attempt %v): %v \n", delivery.ID.Hex(), len(delivery.Attempts)+1, err)
+	}
+	return true
+}
+
+// StartWorkers starts the workers that deliver queued webhooks
+func StartWorkers() {
+	worker.Start(Workers, pollInterval, work)
+}
+
+func getDeliveries(webhookID string, status string, pageNumber string, pageSize string) ([]models.WebhookDelivery, int64, int64, int64, error) {
+	hook, err := getWebhook(webhookID)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+
+	perPage := int64(15)
+	page := int64(1)
+
+	if pageSize != "" {
+		if perPageNum, err := strconv.Atoi(pageSize); err == nil {
+			perPage = int64(perPageNum)
+		}
+	}
+
+	if pageNumber != "" {
+		if num, err := strconv.Atoi(pageNumber); err == nil {
+			page = int64(num)
+		}
+	}
+
+	offset := (page - 1) * perPage
+	filter := bson.M{"webhook_id": hook.ID}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	fOpt := options.FindOptions{Limit: &perPage, Skip: &offset, Sort: bson.D{{Key: "created_at", Value: -1}}}
+
+	total, err := deliveryCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to count deliveries: %v", err)
+	}
+
+	cursor, err := deliveryCollection.Find(ctx, filter, &fOpt)
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to find deliveries: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to decode deliveries: %v", err)
+	}
+
+	return deliveries, total, page, perPage, nil
+}
+
+func getDelivery(webhookID string, ID string) (*models.WebhookDelivery, error) {
+	hookID, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+	objID, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ObjectID: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var delivery models.WebhookDelivery
+	if err := deliveryCollection.FindOne(ctx, bson.M{"_id": objID, "webhook_id": hookID}).Decode(&delivery); err != nil {
+		return nil, fmt.Errorf("delivery not found: %v", err)
+	}
+	return &delivery, nil
+}
+
+// replay queues the exact payload of an earlier delivery again as a new delivery
+func replay(webhookID string, ID string) (*models.WebhookDelivery, error) {
+	original, err := getDelivery(webhookID, ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		ID:            primitive.NewObjectID(),
+		WebhookID:     original.WebhookID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		Attempts:      []models.WebhookAttempt{},
+		NextAttemptAt: now,
+		ReplayOf:      original.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := deliveryCollection.InsertOne(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("could not replay delivery: %v", err)
+	}
+	return &delivery, nil
+}
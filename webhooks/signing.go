@@ -0,0 +1,148 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"league/models"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" followed by the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the webhook secret, so receivers can also reject old replays.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// maxResponse is how much of a receiver's response body is kept in the delivery log
+const maxResponse = 1024
+
+// AllowPrivateNetworks lets webhooks reach loopback and private addresses, for local development only;
+// WEBHOOK_ALLOW_PRIVATE_NETWORKS=true turns it on
+var AllowPrivateNetworks bool = os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+
+// ErrPrivateAddress is returned for receivers inside our own network, such as the cloud metadata service
+var ErrPrivateAddress = errors.New("webhooks cannot be sent to private, loopback or link-local addresses")
+
+// reservedNetworks are not reachable on the internet but are not covered by the net.IP checks
+var reservedNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("198.18.0.0/15"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// isPublic reports whether an address is on the internet rather than in our own network
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAddress runs once the host name is resolved, right before connecting,
+// so a name cannot pass a check and then resolve to an internal address
+func checkAddress(network string, address string, _ syscall.RawConn) error {
+	if AllowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		// no proxy, the address checked has to be the receiver's
+		Proxy:               nil,
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: checkAddress}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	// a redirect could send the delivery, and its response, anywhere
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Sign computes the signature header value for a body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature the way a receiver would
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// post sends one signed delivery and records how it went
+func post(hook models.Webhook, delivery models.WebhookDelivery) models.WebhookAttempt {
+	start := time.Now()
+	attempt := models.WebhookAttempt{At: start}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "league-webhooks/1")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		attempt.DurationMS = time.Since(start).Milliseconds()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = string(response)
+	if !attempt.Succeeded() {
+		attempt.Error = fmt.Sprintf("receiver responded with %v", resp.StatusCode)
+	}
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	return attempt
+}
@@ -0,0 +1,34 @@
+package webhooks
+
+import (
+	"league/events"
+	"league/models"
+)
+
+// queueing deliveries talks to the database, so it never holds up the request that made the change
+func init() {
+	events.SubscribeAsync(func(e events.FixtureCreated) error {
+		return Emit(models.WebhookFixtureCreated, e.Fixture)
+	})
+	events.SubscribeAsync(func(e events.FixtureRescheduled) error {
+		return Emit(models.WebhookFixtureRescheduled, map[string]interface{}{"fixture": e.Fixture, "previous_date": e.PreviousDate})
+	})
+	events.SubscribeAsync(func(e events.FixtureStatusChanged) error {
+		return Emit(models.WebhookFixtureStatus, map[string]interface{}{"fixture": e.Fixture, "previous_status": e.PreviousStatus})
+	})
+	events.SubscribeAsync(func(e events.FixtureScoreChanged) error {
+		return Emit(models.WebhookFixtureScore, map[string]interface{}{
+			"fixture":  e.Fixture,
+			"previous": map[string]int{"home": e.PreviousHome, "away": e.PreviousAway},
+		})
+	})
+	events.SubscribeAsync(func(e events.TeamCreated) error {
+		return Emit(models.WebhookTeamCreated, e.Team)
+	})
+	events.SubscribeAsync(func(e events.TeamUpdated) error {
+		return Emit(models.WebhookTeamUpdated, e.Team)
+	})
+	events.SubscribeAsync(func(e events.TeamDeleted) error {
+		return Emit(models.WebhookTeamDeleted, map[string]interface{}{"_id": e.Team.ID})
+	})
+}
@@ -0,0 +1,139 @@
+package webhooks
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"league/models"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"team.created"}`)
+	signature := Sign("whsec_test", 1700000000, body)
+
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	assert.True(t, Verify("whsec_test", 1700000000, body, signature))
+	assert.False(t, Verify("whsec_other", 1700000000, body, signature))
+	assert.False(t, Verify("whsec_test", 1700000001, body, signature))
+}
+
+func TestPost(t *testing.T) {
+	// the test receivers listen on loopback
+	AllowPrivateNetworks = true
+	defer func() { AllowPrivateNetworks = false }()
+
+	hook := models.Webhook{Secret: "whsec_test"}
+	delivery := models.WebhookDelivery{
+		ID:      primitive.NewObjectID(),
+		Event:   models.WebhookFixtureScore,
+		Payload: `{"event":"fixture.score_changed"}`,
+	}
+
+	received := make(chan *http.Request, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		if !Verify(hook.Secret, timestamp, body, r.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received <- r
+		w.Write([]byte("ok"))
+	}))
+	defer receiver.Close()
+
+	hook.URL = receiver.URL
+	attempt := post(hook, delivery)
+	assert.True(t, attempt.Succeeded())
+	assert.Equal(t, http.StatusOK, attempt.StatusCode)
+	assert.Equal(t, "ok", attempt.Response)
+
+	r := <-received
+	assert.Equal(t, string(models.WebhookFixtureScore), r.Header.Get(EventHeader))
+	assert.Equal(t, delivery.ID.Hex(), r.Header.Get(DeliveryHeader))
+
+	// a wrong secret is rejected by the receiver and logged as a failed attempt
+	hook.Secret = "whsec_other"
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	hook.URL = failing.URL
+	attempt = post(hook, delivery)
+	assert.False(t, attempt.Succeeded())
+	assert.Equal(t, http.StatusInternalServerError, attempt.StatusCode)
+	assert.NotEmpty(t, attempt.Error)
+
+	// unreachable receivers are logged too
+	hook.URL = "http://127.0.0.1:1"
+	attempt = post(hook, delivery)
+	assert.False(t, attempt.Succeeded())
+	assert.NotEmpty(t, attempt.Error)
+}
+
+func TestPostPrivateAddress(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer receiver.Close()
+
+	hook := models.Webhook{Secret: "whsec_test", URL: receiver.URL}
+	delivery := models.WebhookDelivery{ID: primitive.NewObjectID(), Payload: `{}`}
+	attempt := post(hook, delivery)
+	assert.False(t, attempt.Succeeded())
+	assert.Contains(t, attempt.Error, ErrPrivateAddress.Error())
+	assert.Empty(t, attempt.Response)
+
+	assert.False(t, isPublic(net.ParseIP("169.254.169.254")))
+	assert.False(t, isPublic(net.ParseIP("10.0.0.1")))
+	assert.False(t, isPublic(net.ParseIP("::1")))
+	assert.False(t, isPublic(net.ParseIP("::ffff:127.0.0.1")))
+	assert.False(t, isPublic(net.ParseIP("100.100.100.200")))
+	assert.True(t, isPublic(net.ParseIP("93.184.216.34")))
+}
+
+func TestPostRedirect(t *testing.T) {
+	AllowPrivateNetworks = true
+	defer func() { AllowPrivateNetworks = false }()
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer target.Close()
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	hook := models.Webhook{Secret: "whsec_test", URL: redirecting.URL}
+	attempt := post(hook, models.WebhookDelivery{ID: primitive.NewObjectID(), Payload: `{}`})
+	assert.False(t, attempt.Succeeded())
+	assert.Equal(t, http.StatusFound, attempt.StatusCode)
+	assert.NotContains(t, attempt.Response, "secret")
+}
+
+func TestBackoff(t *testing.T) {
+	BaseBackoff = 30 * time.Second
+	MaxBackoff = 6 * time.Hour
+
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, 2*time.Minute, Backoff(3))
+	assert.Equal(t, 6*time.Hour, Backoff(20))
+}
+
+func TestWants(t *testing.T) {
+	hook := models.Webhook{Events: []models.WebhookEvent{models.WebhookTeamCreated}}
+	assert.True(t, hook.Wants(models.WebhookTeamCreated))
+	assert.False(t, hook.Wants(models.WebhookTeamDeleted))
+
+	hook.Events = []models.WebhookEvent{models.AllWebhookEvents}
+	assert.True(t, hook.Wants(models.WebhookTeamDeleted))
+}
@@ -0,0 +1,65 @@
+// Package worker holds what the background queues share: their settings,
+// retry backoff, claiming the next due document and the polling loop.
+package worker
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"context"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvInt reads a positive number from the environment, anything else falls back
+func EnvInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// Backoff is how long to wait after the given number of failed attempts;
+// it starts at base and doubles after every attempt up to max
+func Backoff(base time.Duration, max time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= max {
+			return max
+		}
+	}
+	return wait
+}
+
+// Claim applies update to the due document matched by filter that has waited longest and decodes it into result;
+// it reports false when nothing is due. The filter has to exclude documents another worker has locked.
+func Claim(ctx context.Context, collection *mongo.Collection, filter bson.M, update bson.M, result interface{}) (bool, error) {
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(result)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Start runs job on the given number of goroutines; a worker waits for poll whenever job reports it found nothing to do
+func Start(workers int, poll time.Duration, job func() bool) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				if !job() {
+					time.Sleep(poll)
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvInt(t *testing.T) {
+	os.Setenv("WORKER_TEST_VALUE", "5")
+	defer os.Unsetenv("WORKER_TEST_VALUE")
+	assert.Equal(t, 5, EnvInt("WORKER_TEST_VALUE", 1))
+
+	for _, value := range []string{"", "0", "-3", "ten"} {
+		os.Setenv("WORKER_TEST_VALUE", value)
+		assert.Equal(t, 1, EnvInt("WORKER_TEST_VALUE", 1), value)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(30*time.Second, time.Hour, 0))
+	assert.Equal(t, 30*time.Second, Backoff(30*time.Second, time.Hour, 1))
+	assert.Equal(t, time.Minute, Backoff(30*time.Second, time.Hour, 2))
+	assert.Equal(t, 4*time.Minute, Backoff(30*time.Second, time.Hour, 4))
+	assert.Equal(t, time.Hour, Backoff(30*time.Second, time.Hour, 12))
+	assert.Equal(t, time.Hour, Backoff(30*time.Second, time.Hour, 1000))
+}
+
+func TestStart(t *testing.T) {
+	var runs int32
+	Start(2, time.Millisecond, func() bool {
+		atomic.AddInt32(&runs, 1)
+		return false
+	})
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 4 }, time.Second, time.Millisecond)
+}